@@ -17,18 +17,28 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/swisslearninghub/logsync/metrics"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/clientcredentials"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"sync"
 	"time"
 )
 
 const httpTimeout = 60 * time.Second
 
+// Requests answered with 429 are retried up to rateRetries times after Retry-After, at most retryAfterMax
+const (
+	rateRetries       = 3
+	retryAfterDefault = time.Second
+	retryAfterMax     = time.Minute
+)
+
 const (
 	QueryParamFrom  = "dateFrom"
 	QueryParamTo    = "dateTo"
@@ -41,10 +51,15 @@ const (
 // HubAPI is used to handle OAuth2 requests against core-events endpoint
 type HubAPI struct {
 	client      *http.Client
+	ctx         context.Context // requests and waits are given up once done
 	tokenSource oauth2.TokenSource
 	mu          sync.Mutex
 	tok         *oauth2.Token
+	tokErr      error // error of last token request, nil if it succeeded
 	contextURL  string
+	rateMu      sync.Mutex    // guards next
+	interval    time.Duration // minimum interval between requests, 0 if unlimited
+	next        time.Time     // earliest time of next request
 }
 
 func NewAPI(clientID, clientSecret, tokenURL, contextURL string) (*HubAPI, error) {
@@ -54,6 +69,7 @@ func NewAPI(clientID, clientSecret, tokenURL, contextURL string) (*HubAPI, error
 		Timeout: httpTimeout,
 	}
 	a.contextURL = contextURL
+	a.ctx = context.Background()
 
 	ctx := context.TODO()
 	ctx = context.WithValue(ctx, oauth2.HTTPClient, a.client)
@@ -85,7 +101,7 @@ func (api *HubAPI) QueryClientEvents(params url.Values) ([]EventRepresentation,
 
 	baseURL.RawQuery = params.Encode()
 
-	if req, err = http.NewRequest(http.MethodGet, baseURL.String(), nil); err != nil {
+	if req, err = http.NewRequestWithContext(api.ctx, http.MethodGet, baseURL.String(), nil); err != nil {
 		return nil, err
 	}
 
@@ -95,9 +111,25 @@ func (api *HubAPI) QueryClientEvents(params url.Values) ([]EventRepresentation,
 	token.SetAuthHeader(req)
 
 	var res *http.Response
-	if res, err = api.client.Do(req); err != nil {
-		return nil, err
+	for attempt := 0; ; attempt++ {
+		if err = api.wait(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		if res, err = api.client.Do(req); err != nil {
+			metrics.ObserveAPIRequest(0, start)
+			return nil, err
+		}
+		metrics.ObserveAPIRequest(res.StatusCode, start)
+		if res.StatusCode != http.StatusTooManyRequests || attempt >= rateRetries {
+			break
+		}
+		_ = res.Body.Close()
+		if err = api.sleep(retryAfter(res.Header.Get("Retry-After"), time.Now())); err != nil {
+			return nil, err
+		}
 	}
+	defer func() { _ = res.Body.Close() }()
 	if res.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code from api - expected code 200; got code %d", res.StatusCode)
 	}
@@ -115,6 +147,84 @@ func (api *HubAPI) QueryClientEvents(params url.Values) ([]EventRepresentation,
 	return events, nil
 }
 
+// SetContext sets context requests and waits for rate limit or Retry-After are given up on
+func (api *HubAPI) SetContext(ctx context.Context) {
+	api.ctx = ctx
+}
+
+// SetRateLimit limits requests to n per second, 0 disables the limit
+func (api *HubAPI) SetRateLimit(n float64) {
+	api.rateMu.Lock()
+	defer api.rateMu.Unlock()
+	api.interval = 0
+	if n > 0 {
+		api.interval = time.Duration(float64(time.Second) / n)
+	}
+}
+
+// wait blocks until next request is allowed by rate limit
+func (api *HubAPI) wait() error {
+	api.rateMu.Lock()
+	if api.interval == 0 {
+		api.rateMu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	if api.next.Before(now) {
+		api.next = now
+	}
+	d := api.next.Sub(now)
+	api.next = api.next.Add(api.interval)
+	api.rateMu.Unlock()
+	return api.sleep(d)
+}
+
+// sleep blocks for d or until context is done
+func (api *HubAPI) sleep(d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-api.ctx.Done():
+		return api.ctx.Err()
+	}
+}
+
+// retryAfter returns wait given by Retry-After header in seconds or as HTTP date relative to now, retryAfterDefault
+// if missing or invalid
+func retryAfter(header string, now time.Time) time.Duration {
+	var d time.Duration
+	if n, err := strconv.Atoi(header); err == nil && n >= 0 {
+		d = time.Duration(n) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		d = t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+	} else {
+		return retryAfterDefault
+	}
+	if d < retryAfterMax {
+		return d
+	}
+	return retryAfterMax
+}
+
+// TokenState returns expiry of the cached token and error of the last token request. A token is never requested
+func (api *HubAPI) TokenState() (time.Time, error) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+
+	if api.tokErr != nil {
+		return time.Time{}, api.tokErr
+	}
+	if api.tok == nil {
+		return time.Time{}, errors.New("no token requested yet")
+	}
+	return api.tok.Expiry, nil
+}
+
 // token asserts we have a valid token
 func (api *HubAPI) token() (*oauth2.Token, error) {
 
@@ -126,7 +236,10 @@ func (api *HubAPI) token() (*oauth2.Token, error) {
 	}
 
 	var err error
-	if api.tok, err = api.tokenSource.Token(); err != nil {
+	api.tok, err = api.tokenSource.Token()
+	api.tokErr = err
+	metrics.ObserveTokenRefresh(err)
+	if err != nil {
 		return nil, err
 	}
 
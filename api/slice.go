@@ -0,0 +1,117 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+// Queries of a time range split into day slices fetched concurrently. The API takes dates only (see EventDateLayout),
+// so a day is the smallest slice
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Slice sizes
+const (
+	SliceDay = "day"
+)
+
+// SliceWorkersDefault is the number of slices fetched at once if not given
+const SliceWorkersDefault = 4
+
+// Slice is a time range fetched by a single request
+type Slice struct {
+	From time.Time
+	To   time.Time // exclusive
+	Size string
+}
+
+// Slices splits range from to into slices of given size. Day slices start at local midnight like the dates of a
+// single request
+func Slices(from, to time.Time, size string) ([]Slice, error) {
+	if size != SliceDay {
+		return nil, fmt.Errorf("unknown slice size: %s", size)
+	}
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, from.Location())
+	var slices []Slice
+	for t := from; t.Before(to); t = t.AddDate(0, 0, 1) {
+		slices = append(slices, Slice{From: t, To: t.AddDate(0, 0, 1), Size: size})
+	}
+	return slices, nil
+}
+
+// String returns date of slice
+func (s Slice) String() string {
+	return s.From.Format(EventDateLayout)
+}
+
+// params returns copy of params with range of slice given by date (both inclusive)
+func (s Slice) params(params url.Values) url.Values {
+	p := url.Values{}
+	for k, v := range params {
+		p[k] = v
+	}
+	p.Set(QueryParamFrom, s.From.Format(EventDateLayout))
+	p.Set(QueryParamTo, s.From.Format(EventDateLayout))
+	return p
+}
+
+// QuerySlice fetches events of a single slice
+func (api *HubAPI) QuerySlice(params url.Values, s Slice) ([]EventRepresentation, error) {
+	return api.QueryClientEvents(s.params(params))
+}
+
+// QuerySlices fetches slices concurrently with at most workers requests at once and returns events in time order.
+// Fails if any slice fails
+func (api *HubAPI) QuerySlices(params url.Values, slices []Slice, workers int) ([]EventRepresentation, error) {
+	if workers <= 0 {
+		workers = SliceWorkersDefault
+	}
+
+	results := make([][]EventRepresentation, len(slices))
+	errs := make([]error, len(slices))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(slices); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i], errs[i] = api.QuerySlice(params, slices[i])
+			}
+		}()
+	}
+	for i := range slices {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var events []EventRepresentation
+	for i := range slices {
+		if errs[i] != nil {
+			return nil, fmt.Errorf("slice %s: %w", slices[i], errs[i])
+		}
+		events = append(events, results[i]...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time < events[j].Time
+	})
+
+	return events, nil
+}
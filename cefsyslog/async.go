@@ -0,0 +1,365 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cefsyslog
+
+// Asynchronous writes using a bounded queue and a background sender writing batches
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Async defaults
+const (
+	AsyncQueueSizeDefault     = 10000
+	AsyncBatchSizeDefault     = 100
+	AsyncFlushIntervalDefault = time.Second
+)
+
+var (
+	ErrQueueFull   = errors.New("syslog queue full")
+	ErrQueueClosed = errors.New("syslog queue closed")
+)
+
+// AsyncOptions configure asynchronous writes
+type AsyncOptions struct {
+	QueueSize     int             // maximum of queued messages
+	BatchSize     int             // maximum of messages written at once
+	FlushInterval time.Duration   // maximum time a message is queued while the server is reachable
+	Drop          bool            // drop messages if queue is full instead of blocking
+	Context       context.Context // Log blocking on a full queue gives up once done (optional)
+	OnError       func(error)     // called with errors of background sender
+}
+
+// UnsentError is returned by Flush and Close in async mode if queued messages could not be sent. The writer gives up
+// these messages, Refs holds the references passed to LogFit with them (each once, nil omitted)
+type UnsentError struct {
+	Count int
+	Refs  []interface{}
+	Err   error // last write error
+}
+
+// Error match interface
+func (e *UnsentError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("%d message(s) not sent", e.Count)
+	}
+	return fmt.Sprintf("%d message(s) not sent: %s", e.Count, e.Err.Error())
+}
+
+// Unwrap returns cause
+func (e *UnsentError) Unwrap() error {
+	return e.Err
+}
+
+// message is a queued syslog line and the reference of the caller
+type message struct {
+	b   []byte
+	ref interface{}
+	tcp bool // oversized message sent over TCP (see OversizeTCP)
+}
+
+// async holds state of asynchronous writes
+type async struct {
+	opts    AsyncOptions
+	mu      sync.RWMutex // guards closed
+	closed  bool
+	pending sync.WaitGroup // Log calls adding to queue
+	queue   chan message
+	flush   chan chan error
+	stop    chan struct{} // closed on Close, unblocks Log waiting for queue space
+	quit    chan struct{} // closed once queue is closed, background sender finishes
+	done    chan error
+	dropped uint64
+	lastErr error // error of last write of background sender
+}
+
+// StartAsync switches writer to asynchronous mode. Log queues messages, a background sender writes them in batches.
+// Must be called before first Log.
+func (w *Writer) StartAsync(opts AsyncOptions) {
+	if w.async != nil {
+		return
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = AsyncQueueSizeDefault
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = AsyncBatchSizeDefault
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = AsyncFlushIntervalDefault
+	}
+	if opts.Context == nil {
+		opts.Context = context.Background()
+	}
+	w.async = &async{
+		opts:  opts,
+		queue: make(chan message, opts.QueueSize),
+		flush: make(chan chan error),
+		stop:  make(chan struct{}),
+		quit:  make(chan struct{}),
+		done:  make(chan error),
+	}
+	go w.sender()
+}
+
+// Dropped returns count of messages dropped because queue was full or server unreachable on close
+func (w *Writer) Dropped() uint64 {
+	if w.async == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&w.async.dropped)
+}
+
+// Flush blocks until all queued messages are written. Messages which could not be written are given up and
+// returned as *UnsentError.
+func (w *Writer) Flush() error {
+	a := w.async
+	if a == nil {
+		return nil
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return nil
+	}
+	ch := make(chan error)
+	a.flush <- ch
+	return <-ch
+}
+
+// enqueue adds message to queue. The lock is not held while waiting for queue space, so Close unblocks waiting
+// calls.
+func (w *Writer) enqueue(msg message) error {
+	a := w.async
+
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return ErrQueueClosed
+	}
+	a.pending.Add(1)
+	a.mu.RUnlock()
+	defer a.pending.Done()
+
+	select {
+	case a.queue <- msg:
+		return nil
+	default:
+	}
+	if a.opts.Drop {
+		atomic.AddUint64(&a.dropped, 1)
+		return ErrQueueFull
+	}
+	select {
+	case a.queue <- msg:
+		return nil
+	case <-a.stop:
+		return ErrQueueClosed
+	case <-a.opts.Context.Done():
+		return a.opts.Context.Err()
+	}
+}
+
+// stopAsync closes queue and waits until background sender has written remaining messages. Returns *UnsentError
+// for messages which could not be written
+func (w *Writer) stopAsync() error {
+	a := w.async
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.stop)
+	a.mu.Unlock()
+
+	a.pending.Wait()
+	close(a.queue)
+	close(a.quit)
+	return <-a.done
+}
+
+// sender writes queued messages in batches until writer is closed. While a batch can not be sent, no further
+// messages are taken from queue, so Log blocks or drops once queue is full.
+func (w *Writer) sender() {
+	a := w.async
+	ticker := time.NewTicker(a.opts.FlushInterval)
+	defer ticker.Stop()
+
+	var batch []message
+	var closed bool
+	for {
+		queue := a.queue
+		if closed || len(batch) >= a.opts.BatchSize {
+			queue = nil
+		}
+		select {
+		case m, ok := <-queue:
+			if !ok {
+				// closed by stopAsync, quit follows
+				closed = true
+				continue
+			}
+			batch = append(batch, m)
+			if len(batch) >= a.opts.BatchSize {
+				batch = w.sendBatch(batch)
+			}
+		case <-ticker.C:
+			batch = w.sendBatch(batch)
+		case ch := <-a.flush:
+			ch <- w.unsent(w.drain(batch))
+			batch = nil
+		case <-a.quit:
+			a.done <- w.drop(w.drain(batch))
+			return
+		}
+	}
+}
+
+// drain sends batch and all currently queued messages in batches. Once a batch fails, the remaining messages are
+// taken from queue without sending and returned with the unsent ones.
+func (w *Writer) drain(batch []message) []message {
+	for {
+		if n := w.async.opts.BatchSize - len(batch); n > 0 {
+			batch = w.take(batch, n)
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if batch = w.sendBatch(batch); len(batch) > 0 {
+			return w.take(batch, -1)
+		}
+	}
+}
+
+// take appends up to n currently queued messages to batch, all if n is negative
+func (w *Writer) take(batch []message, n int) []message {
+	for i := 0; n < 0 || i < n; i++ {
+		select {
+		case m, ok := <-w.async.queue:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, m)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// sendBatch writes batch and returns unsent messages. Stream networks get the batch in a single write, datagram
+// networks need a write per message.
+func (w *Writer) sendBatch(batch []message) []message {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var err error
+	if isDatagram(w.network) {
+		for len(batch) > 0 {
+			if batch[0].tcp {
+				err = w.sendTCP(batch[0].b)
+			} else {
+				_, err = w.send(batch[0].b)
+			}
+			if err != nil {
+				break
+			}
+			batch = batch[1:]
+		}
+	} else {
+		batch, err = w.sendStream(batch)
+	}
+	if err != nil {
+		w.async.lastErr = err
+		w.asyncError(err)
+	}
+	return batch
+}
+
+// sendStream writes batch joined and returns messages not completely written. After a partial write, the message
+// cut off and the following ones are written again on a new connection as long as messages get through. It must be
+// called with w.mu held.
+func (w *Writer) sendStream(batch []message) ([]message, error) {
+	var buf bytes.Buffer
+	for {
+		buf.Reset()
+		for _, m := range batch {
+			buf.Write(m.b)
+		}
+		n, err := w.send(buf.Bytes())
+		if err == nil {
+			return nil, nil
+		}
+		sent := 0
+		for len(batch) > 0 && n >= len(batch[0].b) {
+			n -= len(batch[0].b)
+			batch = batch[1:]
+			sent++
+		}
+		if len(batch) == 0 {
+			return nil, nil
+		}
+		if sent == 0 {
+			return batch, err
+		}
+	}
+}
+
+// unsent returns *UnsentError holding references of unsent messages, nil if none
+func (w *Writer) unsent(batch []message) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	e := &UnsentError{Count: len(batch), Err: w.async.lastErr}
+	seen := map[interface{}]bool{}
+	for _, m := range batch {
+		if m.ref == nil || seen[m.ref] {
+			continue
+		}
+		seen[m.ref] = true
+		e.Refs = append(e.Refs, m.ref)
+	}
+	return e
+}
+
+// drop counts remaining messages as dropped and returns them as *UnsentError
+func (w *Writer) drop(batch []message) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	atomic.AddUint64(&w.async.dropped, uint64(len(batch)))
+	return w.unsent(batch)
+}
+
+// asyncError passes err to configured handler
+func (w *Writer) asyncError(err error) {
+	if w.async.opts.OnError != nil {
+		w.async.opts.OnError(err)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cefsyslog
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errTestConn = errors.New("connection reset")
+
+// testConn records writes. Writes block while gate is open, fail if down and once limit bytes are written (if
+// limit > 0)
+type testConn struct {
+	net.Conn
+	mu      sync.Mutex
+	writes  []string
+	written int
+	limit   int
+	down    bool
+	gate    chan struct{}
+}
+
+// Write match interface
+func (c *testConn) Write(b []byte) (int, error) {
+	if c.gate != nil {
+		<-c.gate
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.down {
+		return 0, errTestConn
+	}
+	n := len(b)
+	if c.limit > 0 && c.written+n > c.limit {
+		n = c.limit - c.written
+	}
+	c.written += n
+	c.writes = append(c.writes, string(b[:n]))
+	if n < len(b) {
+		return n, errTestConn
+	}
+	return n, nil
+}
+
+// Close match interface
+func (c *testConn) Close() error {
+	return nil
+}
+
+// LocalAddr match interface
+func (c *testConn) LocalAddr() net.Addr {
+	return &net.TCPAddr{}
+}
+
+// Writes returns copy of recorded writes
+func (c *testConn) Writes() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.writes...)
+}
+
+// refusedAddr returns a local address nobody listens on
+func refusedAddr(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+// testWriter returns writer with given connections, addresses of missing connections are refused
+func testWriter(t *testing.T, network, mode string, conns ...net.Conn) *Writer {
+	w := &Writer{
+		priority: LOG_USER | LOG_INFO,
+		tag:      "test",
+		hostname: "host",
+		network:  network,
+		mode:     mode,
+		recheck:  RecheckDefault,
+		oversize: OversizeTruncate,
+		conns:    conns,
+		tcpConns: make([]net.Conn, len(conns)),
+		checked:  time.Now(),
+	}
+	for range conns {
+		w.raddrs = append(w.raddrs, refusedAddr(t))
+	}
+	return w
+}
+
+func TestAsyncBatchWrites(t *testing.T) {
+	tests := []struct {
+		network string
+		writes  int
+	}{
+		{"tcp", 1},
+		{NetworkUnix, 1},
+		{"udp", 3},
+		{NetworkUnixgram, 3},
+	}
+	for _, tt := range tests {
+		conn := &testConn{}
+		w := testWriter(t, tt.network, ModeFailover, conn)
+		w.StartAsync(AsyncOptions{FlushInterval: time.Hour})
+		for _, m := range []string{"a", "b", "c"} {
+			if err := w.Log(time.Now(), LOG_INFO, m); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.network, err)
+		}
+		writes := conn.Writes()
+		if len(writes) != tt.writes || strings.Count(strings.Join(writes, ""), "\n") != 3 {
+			t.Errorf("%s: got %d write(s) %q, want %d holding 3 messages", tt.network, len(writes), writes, tt.writes)
+		}
+	}
+}
+
+func TestAsyncBackpressure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn := &testConn{gate: make(chan struct{})}
+	w := testWriter(t, "tcp", ModeFailover, conn)
+	w.StartAsync(AsyncOptions{QueueSize: 1, BatchSize: 1, FlushInterval: time.Hour, Context: ctx})
+
+	// first message blocks sender, second fills queue
+	for _, m := range []string{"a", "b"} {
+		if err := w.Log(time.Now(), LOG_INFO, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res := make(chan error)
+	go func() { res <- w.Log(time.Now(), LOG_INFO, "c") }()
+	select {
+	case err := <-res:
+		t.Fatalf("log on full queue returned %v, want blocking", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	cancel()
+	if err := <-res; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled log: got %v, want %v", err, context.Canceled)
+	}
+
+	close(conn.gate)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if writes := conn.Writes(); len(writes) != 2 {
+		t.Errorf("got %d write(s), want 2", len(writes))
+	}
+}
+
+func TestAsyncDrop(t *testing.T) {
+	conn := &testConn{gate: make(chan struct{})}
+	w := testWriter(t, "tcp", ModeFailover, conn)
+	w.StartAsync(AsyncOptions{QueueSize: 1, BatchSize: 1, FlushInterval: time.Hour, Drop: true})
+
+	var full int
+	for i := 0; i < 10; i++ {
+		if err := w.Log(time.Now(), LOG_INFO, "m"); errors.Is(err, ErrQueueFull) {
+			full++
+		}
+	}
+	if full == 0 || w.Dropped() != uint64(full) {
+		t.Errorf("got %d full queue error(s) and %d dropped", full, w.Dropped())
+	}
+	close(conn.gate)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAsyncStopDrains(t *testing.T) {
+	conn := &testConn{}
+	w := testWriter(t, "tcp", ModeFailover, conn)
+	w.StartAsync(AsyncOptions{BatchSize: 2, FlushInterval: time.Hour})
+	for i := 0; i < 5; i++ {
+		if err := w.LogFit(time.Now(), LOG_INFO, "m", nil, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(strings.Join(conn.Writes(), ""), "\n"); n != 5 {
+		t.Errorf("got %d message(s) written, want 5", n)
+	}
+	if err := w.Log(time.Now(), LOG_INFO, "late"); !errors.Is(err, ErrQueueClosed) {
+		t.Errorf("log after close: got %v, want %v", err, ErrQueueClosed)
+	}
+}
+
+func TestAsyncUnsent(t *testing.T) {
+	stamp := time.Now()
+	size := len((&Writer{hostname: "host", tag: "test"}).line(stamp, LOG_USER|LOG_INFO, "a"))
+
+	// first message and part of second get through, reconnecting fails
+	conn := &testConn{limit: size + 3}
+	w := testWriter(t, "tcp", ModeFailover, conn)
+	w.StartAsync(AsyncOptions{FlushInterval: time.Hour})
+	for _, ref := range []interface{}{"a", "b", nil, "c", "c"} {
+		if err := w.LogFit(stamp, LOG_INFO, "a", nil, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var ue *UnsentError
+	if err := w.Flush(); !errors.As(err, &ue) {
+		t.Fatalf("got %v, want *UnsentError", err)
+	}
+	if ue.Count != 4 || !reflect.DeepEqual(ue.Refs, []interface{}{"b", "c"}) || ue.Err == nil {
+		t.Errorf("got %d unsent with refs %v and cause %v, want 4 with refs [b c]", ue.Count, ue.Refs, ue.Err)
+	}
+	if writes := conn.Writes(); len(writes) != 1 || len(writes[0]) != size+3 {
+		t.Errorf("got writes %q, want a single write cut off in second message", writes)
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("close after flush: got %v, want none queued", err)
+	}
+}
@@ -33,6 +33,7 @@ const (
 	ExtSourceUserName = "suser"
 	ExtSourceUserID   = "suid"
 	ExtReceiptTime    = "rt"
+	ExtDeviceExtID    = "deviceExternalId"
 )
 
 // CEF is a single log entry
@@ -0,0 +1,224 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cefsyslog
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	leefPrefix   = "LEEF"
+	LEEFVersion1 = "1.0"
+	LEEFVersion2 = "2.0"
+)
+
+const (
+	AttrCategory      = "cat"
+	AttrSeverity      = "sev"
+	AttrDevTime       = "devTime"
+	AttrDevTimeFormat = "devTimeFormat"
+	AttrSourceAddress = "src"
+	AttrUserName      = "usrName"
+)
+
+// leefAttrFromExt maps CEF extension keys to LEEF attribute keys. Unmapped keys are kept as they are
+var leefAttrFromExt = map[string]string{
+	ExtSourceAddress:  AttrSourceAddress,
+	ExtSourceUserName: AttrUserName,
+	ExtReceiptTime:    "", // replaced by devTime
+}
+
+// javaLayout maps Java SimpleDateFormat tokens (as used by devTimeFormat) to Go layout. Longest tokens first
+var javaLayout = []struct {
+	java   string
+	golang string
+}{
+	{"yyyy", "2006"},
+	{"yy", "06"},
+	{"MMM", "Jan"},
+	{"MM", "01"},
+	{"dd", "02"},
+	{"HH", "15"},
+	{"hh", "03"},
+	{"mm", "04"},
+	{"ss", "05"},
+	{"SSS", "000"},
+	{"a", "PM"},
+	{"zzz", "MST"},
+	{"z", "MST"},
+	{"XXX", "-07:00"},
+	{"Z", "-0700"},
+}
+
+var ErrLEEFDelimiter = errors.New("invalid leef delimiter")
+
+// LEEF is a single log entry
+type LEEF struct {
+	Version       string
+	DeviceVendor  string
+	DeviceProduct string
+	DeviceVersion string
+	EventID       string
+	Delimiter     rune
+	Attributes    Attributes
+}
+
+// Attributes holds LEEF key-value pairs
+type Attributes map[string]string
+
+// NewLEEF returns representation. LEEF 1.0 always uses tab as delimiter
+func NewLEEF(version, vendor, product, devVersion, eventID string, delimiter rune) *LEEF {
+	if version != LEEFVersion2 {
+		version = LEEFVersion1
+		delimiter = '\t'
+	}
+	return &LEEF{
+		Version:       version,
+		DeviceVendor:  vendor,
+		DeviceProduct: product,
+		DeviceVersion: devVersion,
+		EventID:       eventID,
+		Delimiter:     delimiter,
+		Attributes:    map[string]string{},
+	}
+}
+
+// NewLEEFFromCEF returns representation with header and attributes taken from cef
+func NewLEEFFromCEF(cef *CEF, version string, delimiter rune) *LEEF {
+	f := NewLEEF(version, cef.DeviceVendor, cef.DeviceProduct, cef.DeviceVersion, cef.EventClassID, delimiter)
+	f.Attributes[AttrCategory] = cef.Name
+	f.Attributes[AttrSeverity] = fmt.Sprintf("%d", cef.Severity)
+	for key, value := range cef.Extension {
+		if k, ok := leefAttrFromExt[key]; ok {
+			if k == "" {
+				continue
+			}
+			key = k
+		}
+		f.Attributes[key] = value
+	}
+	return f
+}
+
+// ParseLEEFDelimiter returns delimiter from single character or hex notation (i.e. "^", "x5E" or "0x5E")
+func ParseLEEFDelimiter(s string) (rune, error) {
+	if s == "" {
+		return '\t', nil
+	}
+	if r := []rune(s); len(r) == 1 {
+		return r[0], nil
+	}
+	h := strings.TrimPrefix(strings.ToLower(s), "0")
+	if !strings.HasPrefix(h, "x") {
+		return 0, fmt.Errorf("%w: %s", ErrLEEFDelimiter, s)
+	}
+	d, err := strconv.ParseUint(h[1:], 16, 16)
+	if err != nil || d == 0 {
+		return 0, fmt.Errorf("%w: %s", ErrLEEFDelimiter, s)
+	}
+	return rune(d), nil
+}
+
+// JavaTimeLayout converts a Java SimpleDateFormat pattern to Go time layout
+func JavaTimeLayout(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); {
+		matched := false
+		for _, l := range javaLayout {
+			if strings.HasPrefix(pattern[i:], l.java) {
+				sb.WriteString(l.golang)
+				i += len(l.java)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			sb.WriteByte(pattern[i])
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// SetDevTime sets devTime attribute. Epoch milliseconds are used if format (Java SimpleDateFormat) is empty
+func (f *LEEF) SetDevTime(t time.Time, format string) {
+	if format == "" {
+		f.Attributes[AttrDevTime] = fmt.Sprintf("%d", t.UnixMilli())
+		delete(f.Attributes, AttrDevTimeFormat)
+		return
+	}
+	f.Attributes[AttrDevTime] = t.Format(JavaTimeLayout(format))
+	f.Attributes[AttrDevTimeFormat] = format
+}
+
+// String returns formatted and escaped string representation
+func (f *LEEF) String() string {
+	s := fmt.Sprintf(
+		"%s:%s|%s|%s|%s|%s|",
+		leefPrefix,
+		f.Version,
+		f.escape(f.DeviceVendor),
+		f.escape(f.DeviceProduct),
+		f.escape(f.DeviceVersion),
+		f.escape(f.EventID),
+	)
+	if f.Version == LEEFVersion2 {
+		s += f.delimiter() + "|"
+	}
+	return s + f.Attributes.join(f.Delimiter)
+}
+
+// delimiter returns header representation of delimiter
+func (f *LEEF) delimiter() string {
+	if f.Delimiter > ' ' && f.Delimiter != '|' && f.Delimiter < 0x7f {
+		return string(f.Delimiter)
+	}
+	return fmt.Sprintf("x%02X", f.Delimiter)
+}
+
+// escape is used for header field escapes
+func (f *LEEF) escape(s string) string {
+	rep := strings.NewReplacer(
+		"\\", "\\\\",
+		"|", "\\|",
+		"\n", "\\n",
+	)
+	return rep.Replace(s)
+}
+
+// join returns attributes sorted by key, separated by delimiter
+func (a Attributes) join(delimiter rune) string {
+	keys := make([]string, 0, len(a))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	rep := strings.NewReplacer(
+		"\\", "\\\\",
+		"\n", "\\n",
+		"\r", "\\r",
+		string(delimiter), "\\"+string(delimiter),
+	)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", rep.Replace(key), rep.Replace(a[key])))
+	}
+	return strings.Join(pairs, string(delimiter))
+}
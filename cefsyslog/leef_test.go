@@ -0,0 +1,137 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cefsyslog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testCEF returns entry with escapes needed in header and extension
+func testCEF() *CEF {
+	cef := NewCEF("LOGIN|OK", "Login", LOG_NOTICE)
+	cef.DeviceVendor = `Vendor\Inc`
+	cef.Extension[ExtSourceAddress] = "10.0.0.1"
+	cef.Extension[ExtSourceUserName] = "a^b\tc"
+	cef.Extension[ExtReceiptTime] = "1000"
+	cef.Extension["msg"] = "line\r\nnext"
+	return cef
+}
+
+func TestLEEFString(t *testing.T) {
+	tests := []struct {
+		name      string
+		version   string
+		delimiter rune
+		want      string
+	}{
+		{
+			name:      "1.0 tab",
+			version:   LEEFVersion1,
+			delimiter: '^', // ignored by 1.0
+			want: `LEEF:1.0|Vendor\\Inc|LMS|1.0.0|LOGIN\|OK|` +
+				"cat=Login\tdevTime=1000\tmsg=line\\r\\nnext\tsev=5\tsrc=10.0.0.1\tusrName=a^b\\\tc",
+		},
+		{
+			name:      "2.0 caret",
+			version:   LEEFVersion2,
+			delimiter: '^',
+			want: `LEEF:2.0|Vendor\\Inc|LMS|1.0.0|LOGIN\|OK|^|` +
+				`cat=Login^devTime=1000^msg=line\r\nnext^sev=5^src=10.0.0.1^usrName=a\^b` + "\tc",
+		},
+		{
+			name:      "2.0 pipe in hex",
+			version:   LEEFVersion2,
+			delimiter: '|',
+			want: `LEEF:2.0|Vendor\\Inc|LMS|1.0.0|LOGIN\|OK|x7C|` +
+				`cat=Login|devTime=1000|msg=line\r\nnext|sev=5|src=10.0.0.1|usrName=a^b` + "\tc",
+		},
+		{
+			name:      "2.0 tab in hex",
+			version:   LEEFVersion2,
+			delimiter: '\t',
+			want: `LEEF:2.0|Vendor\\Inc|LMS|1.0.0|LOGIN\|OK|x09|` +
+				"cat=Login\tdevTime=1000\tmsg=line\\r\\nnext\tsev=5\tsrc=10.0.0.1\tusrName=a^b\\\tc",
+		},
+	}
+	for _, tt := range tests {
+		leef := NewLEEFFromCEF(testCEF(), tt.version, tt.delimiter)
+		leef.SetDevTime(time.UnixMilli(1000), "")
+		if got := leef.String(); got != tt.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLEEFDevTime(t *testing.T) {
+	leef := NewLEEF(LEEFVersion1, "v", "p", "1", "e", 0)
+	stamp := time.Date(2023, 5, 4, 13, 2, 3, 45e6, time.UTC)
+
+	leef.SetDevTime(stamp, "MMM dd yyyy HH:mm:ss.SSS zzz")
+	want := "devTime=May 04 2023 13:02:03.045 UTC\tdevTimeFormat=MMM dd yyyy HH:mm:ss.SSS zzz"
+	if got := leef.Attributes.join(leef.Delimiter); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	leef.SetDevTime(stamp, "")
+	if got := leef.Attributes.join(leef.Delimiter); got != "devTime=1683205323045" {
+		t.Errorf("epoch: got %q", got)
+	}
+}
+
+func TestJavaTimeLayout(t *testing.T) {
+	tests := []struct {
+		java, want string
+	}{
+		{"yyyy-MM-dd'T'HH:mm:ss.SSSXXX", "2006-01-02'T'15:04:05.000-07:00"},
+		{"yy/MM/dd hh:mm a Z", "06/01/02 03:04 PM -0700"},
+		{"MMM dd HH:mm:ss z", "Jan 02 15:04:05 MST"},
+	}
+	for _, tt := range tests {
+		if got := JavaTimeLayout(tt.java); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.java, got, tt.want)
+		}
+	}
+}
+
+func TestParseLEEFDelimiter(t *testing.T) {
+	tests := []struct {
+		s    string
+		want rune
+		err  bool
+	}{
+		{"", '\t', false},
+		{"^", '^', false},
+		{"x5E", '^', false},
+		{"0x5e", '^', false},
+		{"X09", '\t', false},
+		{"x00", 0, true},
+		{"xZZ", 0, true},
+		{"ab", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLEEFDelimiter(tt.s)
+		if tt.err {
+			if !errors.Is(err, ErrLEEFDelimiter) {
+				t.Errorf("%q: got %v, want %v", tt.s, err, ErrLEEFDelimiter)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.s, got, err, tt.want)
+		}
+	}
+}
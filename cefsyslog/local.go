@@ -0,0 +1,50 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cefsyslog
+
+// Local syslog daemon via unix domain socket
+
+// Local networks
+const (
+	NetworkUnix     = "unix"
+	NetworkUnixgram = "unixgram"
+)
+
+// localPaths are tried if no path to local syslog socket is given
+var localPaths = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// isLocal returns true for unix domain socket networks
+func isLocal(network string) bool {
+	return network == NetworkUnix || network == NetworkUnixgram
+}
+
+// isDatagram returns true for networks which need a single write per message
+func isDatagram(network string) bool {
+	return network == "udp" || network == NetworkUnixgram
+}
+
+// localAddrs returns given non-empty socket paths or default paths if none given
+func localAddrs(raddrs []string) []string {
+	var paths []string
+	for _, path := range raddrs {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return localPaths
+	}
+	return paths
+}
@@ -0,0 +1,197 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cefsyslog
+
+// Maximum message size handling
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// Policies for messages exceeding max size
+const (
+	OversizeTruncate = "truncate"
+	OversizeSplit    = "split"
+	OversizeTCP      = "tcp"
+)
+
+// Default maximum sizes of a syslog message over UDP (RFC 5426) and datagram Unix sockets (default of rsyslog and
+// syslog-ng). Stream transports are unlimited by default.
+const (
+	MaxSizeUDPDefault      = 2048
+	MaxSizeUnixgramDefault = 8192
+)
+
+// SetMaxSize sets maximum size of syslog messages including header and policy applied to larger messages.
+// Zero size keeps the default of the transport.
+func (w *Writer) SetMaxSize(size int, policy string) error {
+	switch policy {
+	case "":
+		policy = OversizeTruncate
+	case OversizeTruncate, OversizeSplit:
+	case OversizeTCP:
+		if w.network != "udp" {
+			return fmt.Errorf("oversize policy %s requires udp", policy)
+		}
+	default:
+		return fmt.Errorf("unknown oversize policy: %s", policy)
+	}
+	if size > 0 {
+		w.maxSize = size
+	}
+	w.oversize = policy
+	return nil
+}
+
+// maxSizeDefault returns default maximum message size of network, 0 if unlimited
+func maxSizeDefault(network string) int {
+	switch network {
+	case "udp":
+		return MaxSizeUDPDefault
+	case NetworkUnixgram:
+		return MaxSizeUnixgramDefault
+	}
+	return 0
+}
+
+// Oversized returns count of messages exceeding max size
+func (w *Writer) Oversized() uint64 {
+	return atomic.LoadUint64(&w.oversized)
+}
+
+// LogFit writes log like Log. If message exceeds max size, shrink (optional) is called with the available size for
+// the message to return a shorter one. Messages still exceeding max size are handled according to oversize policy.
+// In async mode ref (optional) identifies the message in *UnsentError of Flush and Close.
+func (w *Writer) LogFit(stamp time.Time, p Priority, m string, shrink func(avail int) string, ref interface{}) error {
+	avail := w.available(stamp, p)
+	if avail <= 0 || len(m) <= avail {
+		return w.log(stamp, p, m, ref)
+	}
+	atomic.AddUint64(&w.oversized, 1)
+	if shrink != nil {
+		if m = shrink(avail); len(m) <= avail {
+			return w.log(stamp, p, m, ref)
+		}
+	}
+	switch w.oversize {
+	case OversizeSplit:
+		parts, err := split(m, avail)
+		if err != nil {
+			return err
+		}
+		for _, part := range parts {
+			if err = w.log(stamp, p, part, ref); err != nil {
+				return err
+			}
+		}
+		return nil
+	case OversizeTCP:
+		return w.logTCP(stamp, p, m, ref)
+	default:
+		return w.log(stamp, p, TruncateUTF8(m, avail), ref)
+	}
+}
+
+// split returns parts of m fitting into avail bytes each. Parts are prefixed "[<id> <n>/<total>] " with id derived
+// from m, so fragments of a message resent after a failure can be recognized
+func split(m string, avail int) ([]string, error) {
+	id := fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(m)))
+	// prefix is longest with part number and total of the most parts possible
+	size := avail - len(splitPrefix(id, len(m), len(m)))
+	if size < utf8.UTFMax {
+		return nil, fmt.Errorf("%d byte(s) left within max size, too few to split message", avail)
+	}
+
+	var chunks []string
+	for len(m) > 0 {
+		chunk := TruncateUTF8(m, size)
+		chunks = append(chunks, chunk)
+		m = m[len(chunk):]
+	}
+	parts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		parts[i] = splitPrefix(id, i+1, len(chunks)) + chunk
+	}
+	return parts, nil
+}
+
+// splitPrefix returns prefix of part n of total parts
+func splitPrefix(id string, n, total int) string {
+	return fmt.Sprintf("[%s %d/%d] ", id, n, total)
+}
+
+// TruncateUTF8 returns s cut to at most n bytes without splitting a multibyte character
+func TruncateUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// available returns bytes available for a message within max size. Zero if unlimited.
+func (w *Writer) available(stamp time.Time, p Priority) int {
+	if w.maxSize <= 0 {
+		return 0
+	}
+	avail := w.maxSize - len(w.line(stamp, (w.priority&facilityMask)|(p&severityMask), ""))
+	if avail <= 0 {
+		// header alone exceeds max size, keep at least a single byte of message
+		return 1
+	}
+	return avail
+}
+
+// logTCP writes or queues message to be sent over TCP. In async mode it keeps its place in the queue
+func (w *Writer) logTCP(stamp time.Time, p Priority, m string, ref interface{}) error {
+	msg := message{b: w.line(stamp, (w.priority&facilityMask)|(p&severityMask), m), ref: ref, tcp: true}
+	if w.async != nil {
+		return w.enqueue(msg)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.sendTCP(msg.b)
+}
+
+// sendTCP writes b over TCP to the current syslog server. It must be called with w.mu held.
+func (w *Writer) sendTCP(b []byte) error {
+	i := w.current
+	if w.tcpConns[i] != nil {
+		if _, err := w.tcpConns[i].Write(b); err == nil {
+			return nil
+		}
+		_ = w.tcpConns[i].Close()
+		w.tcpConns[i] = nil
+	}
+	c, err := net.DialTimeout("tcp", w.raddrs[i], DialTimeout)
+	if err != nil {
+		return err
+	}
+	w.tcpConns[i] = c
+	_, err = c.Write(b)
+	return err
+}
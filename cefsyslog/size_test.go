@@ -0,0 +1,147 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cefsyslog
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"abc", 5, "abc"},
+		{"abc", 3, "abc"},
+		{"abc", 2, "ab"},
+		{"abc", 0, ""},
+		{"abc", -1, ""},
+		{"aä", 2, "a"},  // ä is 2 bytes
+		{"aä", 3, "aä"}, // exact fit
+		{"a€b", 3, "a"}, // € is 3 bytes
+		{"a€b", 4, "a€"},
+		{"😀", 3, ""}, // 4 bytes, nothing fits
+	}
+	for _, tt := range tests {
+		if got := TruncateUTF8(tt.s, tt.n); got != tt.want {
+			t.Errorf("TruncateUTF8(%q, %d): got %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name  string
+		m     string
+		avail int
+		want  []string
+	}{
+		{
+			name:  "single part",
+			m:     "abc",
+			avail: 20,
+			want:  []string{"[352441c2 1/1] abc"},
+		},
+		{
+			name:  "even parts",
+			m:     "abcdefgh",
+			avail: 19, // prefix of up to 8 parts takes 15 bytes
+			want:  []string{"[aeef2a50 1/2] abcd", "[aeef2a50 2/2] efgh"},
+		},
+		{
+			name:  "multibyte not cut",
+			m:     "ääää",
+			avail: 20,
+			want:  []string{"[bbd16aa4 1/2] ää", "[bbd16aa4 2/2] ää"},
+		},
+	}
+	for _, tt := range tests {
+		parts, err := split(tt.m, tt.avail)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(parts, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, parts, tt.want)
+		}
+	}
+}
+
+func TestSplitFits(t *testing.T) {
+	m := strings.Repeat("aé€😀", 400)
+	for _, avail := range []int{30, 64, 100, 481} {
+		parts, err := split(m, avail)
+		if err != nil {
+			t.Fatalf("avail %d: %v", avail, err)
+		}
+		var joined string
+		for i, part := range parts {
+			if len(part) > avail || !utf8.ValidString(part) {
+				t.Errorf("avail %d: part %d of %d bytes exceeds or is invalid", avail, i+1, len(part))
+			}
+			joined += part[strings.Index(part, "] ")+2:]
+		}
+		if joined != m {
+			t.Errorf("avail %d: parts do not join to message", avail)
+		}
+	}
+}
+
+func TestSplitTooSmall(t *testing.T) {
+	m := strings.Repeat("a", 1000)
+	// prefix of 1000 parts takes 21 bytes, 3 are left
+	if _, err := split(m, 24); err == nil {
+		t.Error("got no error with less than a multibyte character left for message")
+	}
+	if _, err := split(m, 25); err != nil {
+		t.Errorf("got %v with a multibyte character left for message", err)
+	}
+}
+
+func TestOversizeTCPQueued(t *testing.T) {
+	udp := &testConn{}
+	w := testWriter(t, "udp", ModeFailover, udp)
+	if err := w.SetMaxSize(100, OversizeTCP); err != nil {
+		t.Fatal(err)
+	}
+	w.StartAsync(AsyncOptions{FlushInterval: time.Hour})
+
+	long := strings.Repeat("x", 200)
+	for _, m := range []string{"a", long, "b"} {
+		if err := w.LogFit(time.Now(), LOG_INFO, m, nil, m[:1]); err != nil {
+			t.Fatalf("got %v, want oversized message queued", err)
+		}
+	}
+
+	// nobody listens for TCP, the oversized message and the following ones are unsent
+	var ue *UnsentError
+	if err := w.Close(); !errors.As(err, &ue) {
+		t.Fatalf("got %v, want *UnsentError", err)
+	}
+	if ue.Count != 2 || !reflect.DeepEqual(ue.Refs, []interface{}{"x", "b"}) {
+		t.Errorf("got %d unsent with refs %v, want 2 with refs [x b]", ue.Count, ue.Refs)
+	}
+	if writes := udp.Writes(); len(writes) != 1 || !strings.HasSuffix(writes[0], ": a\n") {
+		t.Errorf("got udp writes %q, want only the message before the oversized one", writes)
+	}
+	if w.Oversized() != 1 {
+		t.Errorf("got %d oversized, want 1", w.Oversized())
+	}
+}
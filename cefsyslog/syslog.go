@@ -69,26 +69,69 @@ const (
 	LOG_LOCAL7
 )
 
-// A Writer is a connection to a remote syslog server.
+// Modes for writers with multiple remote addresses
+const (
+	ModeFailover   = "failover"
+	ModeRoundRobin = "roundrobin"
+)
+
+// RecheckDefault is the interval a failover writer retries preferred addresses in
+const RecheckDefault = time.Minute
+
+// DialTimeout limits connecting to a syslog server, so an unresponsive server does not hold up failover
+const DialTimeout = 5 * time.Second
+
+// A Writer is a connection to one or more remote syslog servers.
 type Writer struct {
-	priority Priority
-	tag      string
-	hostname string
-	network  string
-	raddr    string
-	stamp    time.Time
-	mu       sync.Mutex // guards conn
-	conn     net.Conn
+	priority  Priority
+	tag       string
+	hostname  string
+	network   string
+	raddrs    []string
+	mode      string
+	recheck   time.Duration
+	async     *async
+	maxSize   int    // maximum size of syslog message, 0 if unlimited
+	oversize  string // policy for messages exceeding maxSize
+	oversized uint64
+	mu        sync.Mutex // guards conns, tcpConns, current, next, checked and lastErr
+	conns     []net.Conn // connection per raddr
+	tcpConns  []net.Conn // tcp connection per raddr for oversized messages
+	current   int        // index of raddr last written to
+	next      int        // index of raddr to write to next (round-robin)
+	checked   time.Time  // last recheck of preferred raddrs (failover)
+	lastErr   error      // error of last write, nil if it succeeded
 }
 
-// SyslogWriterDial establishes connection to remote log daemon
+// SyslogWriterDial establishes connection to remote log daemon. Empty network connects to the local log daemon
 func SyslogWriterDial(network, raddr string, priority Priority, tag string) (*Writer, error) {
-	if network == "" {
-		return nil, errors.New("local logging not implemented")
+	return SyslogWriterDialMulti(network, []string{raddr}, ModeFailover, 0, priority, tag)
+}
+
+// SyslogWriterDialMulti establishes connection to the first reachable of given remote log daemons. In failover mode
+// messages are written to the first reachable address, preferred addresses (earlier in list) are retried after
+// recheck interval. In round-robin mode messages are distributed over all reachable addresses. Networks unix and
+// unixgram take socket paths as addresses, empty network tries both with local default paths if none given.
+func SyslogWriterDialMulti(network string, raddrs []string, mode string, recheck time.Duration, priority Priority, tag string) (*Writer, error) {
+	if network == "" || isLocal(network) {
+		raddrs = localAddrs(raddrs)
 	}
 	if priority < 0 || priority > LOG_LOCAL7|LOG_DEBUG {
 		return nil, errors.New("invalid priority")
 	}
+	if len(raddrs) == 0 {
+		return nil, errors.New("no remote address")
+	}
+	switch mode {
+	case "":
+		mode = ModeFailover
+	case ModeFailover, ModeRoundRobin:
+	default:
+		return nil, fmt.Errorf("unknown mode: %s", mode)
+	}
+	if recheck <= 0 {
+		recheck = RecheckDefault
+	}
 
 	if tag == "" {
 		tag = os.Args[0]
@@ -100,56 +143,92 @@ func SyslogWriterDial(network, raddr string, priority Priority, tag string) (*Wr
 		tag:      tag,
 		hostname: hostname,
 		network:  network,
-		raddr:    raddr,
+		raddrs:   raddrs,
+		mode:     mode,
+		recheck:  recheck,
+		oversize: OversizeTruncate,
+		conns:    make([]net.Conn, len(raddrs)),
+		tcpConns: make([]net.Conn, len(raddrs)),
 	}
-
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	err := w.connect()
-	if err != nil {
-		return nil, err
+	// local syslog daemon may listen on datagram or stream socket
+	networks := []string{network}
+	if network == "" {
+		networks = []string{NetworkUnixgram, NetworkUnix}
+	}
+
+	var err error
+	for _, w.network = range networks {
+		for i := range w.raddrs {
+			if err = w.connect(i); err == nil {
+				w.maxSize = maxSizeDefault(w.network)
+				w.current = i
+				w.next = i
+				w.checked = time.Now()
+				return w, nil
+			}
+		}
 	}
-	return w, err
+	return nil, err
 }
 
 // Write sends a log message to the syslog daemon.
 func (w *Writer) Write(b []byte) (int, error) {
-	return w.writeAndRetry(w.priority, string(b))
+	return w.writeAndRetry(time.Now(), w.priority, string(b))
 }
 
-// Close closes a connection to the syslog daemon.
+// Close closes all connections to syslog daemons. In async mode queued messages are sent first, messages which
+// could not be sent are returned as *UnsentError.
 func (w *Writer) Close() error {
+	errAsync := w.stopAsync()
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	if w.conn != nil {
-		err := w.conn.Close()
-		w.conn = nil
-		return err
+	var err error
+	for i, conn := range w.conns {
+		if conn != nil {
+			if e := conn.Close(); e != nil {
+				err = e
+			}
+			w.conns[i] = nil
+		}
+		if w.tcpConns[i] != nil {
+			_ = w.tcpConns[i].Close()
+			w.tcpConns[i] = nil
+		}
+	}
+	if errAsync != nil {
+		err = errAsync
 	}
-	return nil
+	return err
 }
 
-// Log writes log using given timestamp
+// Log writes log using given timestamp. In async mode the message is queued. Messages exceeding max size are handled
+// according to oversize policy.
 func (w *Writer) Log(stamp time.Time, p Priority, m string) error {
-	w.stamp = stamp
-	_, err := w.writeAndRetry(p, m)
-	return err
+	return w.LogFit(stamp, p, m, nil, nil)
 }
 
-// connect makes a connection to the syslog server. It must be called with w.mu held.
-func (w *Writer) connect() (err error) {
-	if w.conn != nil {
-		// ignore err from close, it makes sense to continue anyway
-		_ = w.conn.Close()
-		w.conn = nil
+// log writes or queues message
+func (w *Writer) log(stamp time.Time, p Priority, m string, ref interface{}) error {
+	if w.async != nil {
+		return w.enqueue(message{b: w.line(stamp, (w.priority&facilityMask)|(p&severityMask), m), ref: ref})
 	}
+	_, err := w.writeAndRetry(stamp, p, m)
+	return err
+}
+
+// connect makes a connection to the syslog server at given index. It must be called with w.mu held.
+func (w *Writer) connect(i int) (err error) {
+	w.disconnect(i)
 
 	var c net.Conn
-	c, err = net.Dial(w.network, w.raddr)
+	c, err = net.DialTimeout(w.network, w.raddrs[i], DialTimeout)
 	if err == nil {
-		w.conn = c
+		w.conns[i] = c
 		if w.hostname == "" {
 			w.hostname = c.LocalAddr().String()
 		}
@@ -158,45 +237,147 @@ func (w *Writer) connect() (err error) {
 	return
 }
 
-func (w *Writer) writeAndRetry(p Priority, s string) (int, error) {
+// disconnect closes connection at given index. It must be called with w.mu held.
+func (w *Writer) disconnect(i int) {
+	if w.conns[i] != nil {
+		// ignore err from close, it makes sense to continue anyway
+		_ = w.conns[i].Close()
+		w.conns[i] = nil
+	}
+}
+
+// order returns indexes of raddrs in the order they are tried for next message. It must be called with w.mu held.
+func (w *Writer) order() []int {
+	n := len(w.raddrs)
+	idx := make([]int, 0, n)
+	if w.mode == ModeRoundRobin {
+		for i := 0; i < n; i++ {
+			idx = append(idx, (w.next+i)%n)
+		}
+		w.next = (w.next + 1) % n
+		return idx
+	}
+	idx = append(idx, w.current)
+	for i := 0; i < n; i++ {
+		if i != w.current {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// recheckPreferred switches back to a preferred raddr in failover mode if reachable again. Datagram networks are
+// not rechecked, dialing succeeds there without reaching the server. It must be called with w.mu held.
+func (w *Writer) recheckPreferred() {
+	if w.mode != ModeFailover || isDatagram(w.network) || w.current == 0 || time.Since(w.checked) < w.recheck {
+		return
+	}
+	w.checked = time.Now()
+	for i := 0; i < w.current; i++ {
+		if err := w.connect(i); err == nil {
+			w.disconnect(w.current)
+			w.current = i
+			return
+		}
+	}
+}
+
+func (w *Writer) writeAndRetry(stamp time.Time, p Priority, s string) (int, error) {
 	pr := (w.priority & facilityMask) | (p & severityMask)
+	b := w.line(stamp, pr, s)
 
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
-	if w.conn != nil {
-		if n, err := w.write(pr, s); err == nil {
-			return n, err
+	if _, err := w.send(b); err != nil {
+		return 0, err
+	}
+	// Note: return the length of the input, not the number of
+	// bytes written, because this must behave like an io.Writer.
+	return len(s), nil
+}
+
+// send writes b to current (failover) or next (round-robin) syslog server, reconnecting and trying further servers
+// on failure. Returns bytes written. A write failing after part of b was written is not retried, so the caller
+// decides what to resend. It must be called with w.mu held.
+func (w *Writer) send(b []byte) (int, error) {
+	w.recheckPreferred()
+
+	var err error
+	for _, i := range w.order() {
+		if w.conns[i] != nil {
+			n, e := w.conns[i].Write(b)
+			if e == nil {
+				w.use(i)
+				return n, nil
+			}
+			if n > 0 {
+				return w.broken(i, n, e)
+			}
+		}
+		if err = w.connect(i); err != nil {
+			continue
+		}
+		var n int
+		if n, err = w.conns[i].Write(b); err == nil {
+			w.use(i)
+			return n, nil
+		}
+		if n > 0 {
+			return w.broken(i, n, err)
 		}
 	}
-	if err := w.connect(); err != nil {
-		return 0, err
+	w.lastErr = err
+	return 0, err
+}
+
+// broken closes connection at given index after a partial write of n bytes failed with err. It must be called with
+// w.mu held.
+func (w *Writer) broken(i, n int, err error) (int, error) {
+	w.disconnect(i)
+	w.lastErr = err
+	return n, err
+}
+
+// ConnState returns count of open connections and error of last write, nil if it succeeded
+func (w *Writer) ConnState() (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var n int
+	for _, conn := range w.conns {
+		if conn != nil {
+			n++
+		}
 	}
-	return w.write(pr, s)
+	return n, w.lastErr
 }
 
-// write generates and writes a syslog formatted string. The
+// use marks raddr at given index as current. It must be called with w.mu held.
+func (w *Writer) use(i int) {
+	w.lastErr = nil
+	if w.mode == ModeFailover && i != w.current {
+		w.disconnect(w.current)
+		w.checked = time.Now()
+	}
+	w.current = i
+}
+
+// line generates a syslog formatted message. The
 // format is as follows: <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG
-func (w *Writer) write(p Priority, msg string) (int, error) {
+func (w *Writer) line(stamp time.Time, p Priority, msg string) []byte {
 	// ensure it ends in a \n
 	nl := ""
 	if !strings.HasSuffix(msg, "\n") {
 		nl = "\n"
 	}
-	// pass on timestamp configured in writer
-	err := w.writeString(w.stamp, p, w.hostname, w.tag, msg, nl)
-	if err != nil {
-		return 0, err
+	// local syslog daemon adds hostname itself
+	if isLocal(w.network) {
+		return []byte(fmt.Sprintf("<%d>%s %s[%d]: %s%s",
+			p, stamp.Format(time.RFC3339),
+			w.tag, os.Getpid(), msg, nl))
 	}
-	// Note: return the length of the input, not the number of
-	// bytes printed by Fprintf, because this must behave like
-	// an io.Writer.
-	return len(msg), nil
-}
-
-func (w *Writer) writeString(stamp time.Time, p Priority, hostname, tag, msg, nl string) error {
-	_, err := fmt.Fprintf(w.conn, "<%d>%s %s %s[%d]: %s%s",
-		p, stamp.Format(time.RFC3339), hostname,
-		tag, os.Getpid(), msg, nl)
-	return err
+	return []byte(fmt.Sprintf("<%d>%s %s %s[%d]: %s%s",
+		p, stamp.Format(time.RFC3339), w.hostname,
+		w.tag, os.Getpid(), msg, nl))
 }
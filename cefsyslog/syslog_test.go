@@ -0,0 +1,174 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cefsyslog
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// listenTCP starts a collector passing received messages to returned channel, closed at end of test
+func listenTCP(t *testing.T) (string, <-chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				s := bufio.NewScanner(c)
+				for s.Scan() {
+					lines <- s.Text()
+				}
+			}()
+		}
+	}()
+	return l.Addr().String(), lines
+}
+
+// received returns indexes of conns in the order they received a write each
+func received(conns ...*testConn) []int {
+	var got []int
+	for i, c := range conns {
+		for range c.Writes() {
+			got = append(got, i)
+		}
+	}
+	return got
+}
+
+func TestFailoverOrder(t *testing.T) {
+	primary, secondary, tertiary := &testConn{down: true}, &testConn{}, &testConn{}
+	w := testWriter(t, "tcp", ModeFailover, primary, secondary, tertiary)
+
+	for i := 0; i < 2; i++ {
+		if err := w.Log(time.Now(), LOG_INFO, "m"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := received(primary, secondary, tertiary); !reflect.DeepEqual(got, []int{1, 1}) {
+		t.Errorf("got writes to %v, want [1 1]", got)
+	}
+	if w.current != 1 || w.conns[0] != nil {
+		t.Errorf("got current %d with primary connection %v, want secondary and primary closed", w.current, w.conns[0])
+	}
+
+	secondary.down = true
+	if err := w.Log(time.Now(), LOG_INFO, "m"); err != nil {
+		t.Fatal(err)
+	}
+	if len(tertiary.Writes()) != 1 || w.current != 2 {
+		t.Errorf("got current %d, want tertiary after secondary failed", w.current)
+	}
+
+	tertiary.down = true
+	if err := w.Log(time.Now(), LOG_INFO, "m"); err == nil {
+		t.Error("got no error with all servers down")
+	}
+	if _, err := w.ConnState(); err == nil {
+		t.Error("got no error of last write with all servers down")
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	a, b, c := &testConn{}, &testConn{}, &testConn{}
+	w := testWriter(t, "tcp", ModeRoundRobin, a, b, c)
+
+	var got []int
+	counts := make([]int, 3)
+	for i := 0; i < 5; i++ {
+		if i == 3 {
+			b.down = true
+		}
+		if err := w.Log(time.Now(), LOG_INFO, "m"); err != nil {
+			t.Fatal(err)
+		}
+		for j, conn := range []*testConn{a, b, c} {
+			if n := len(conn.Writes()); n > counts[j] {
+				got = append(got, j)
+				counts[j] = n
+			}
+		}
+	}
+	// b is skipped once down, its turn goes to c
+	if want := []int{0, 1, 2, 0, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got writes to %v, want %v", got, want)
+	}
+}
+
+func TestRecheckPreferred(t *testing.T) {
+	addr, lines := listenTCP(t)
+	secondary := &testConn{}
+	w := testWriter(t, "tcp", ModeFailover, nil, secondary)
+	w.raddrs[0] = addr
+	w.current = 1
+
+	if err := w.Log(time.Now(), LOG_INFO, "before"); err != nil {
+		t.Fatal(err)
+	}
+	if w.current != 1 {
+		t.Fatalf("switched to preferred server before recheck interval")
+	}
+
+	w.checked = time.Now().Add(-w.recheck)
+	if err := w.Log(time.Now(), LOG_INFO, "after"); err != nil {
+		t.Fatal(err)
+	}
+	if w.current != 0 || w.conns[1] != nil {
+		t.Errorf("got current %d, want preferred server after recheck", w.current)
+	}
+	select {
+	case line := <-lines:
+		if !strings.HasSuffix(line, "after") {
+			t.Errorf("preferred server got %q", line)
+		}
+	case <-time.After(time.Second):
+		t.Error("preferred server got no message")
+	}
+	if writes := secondary.Writes(); len(writes) != 1 {
+		t.Errorf("secondary got %d write(s), want 1", len(writes))
+	}
+}
+
+func TestRecheckDatagram(t *testing.T) {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+
+	secondary := &testConn{}
+	w := testWriter(t, "udp", ModeFailover, nil, secondary)
+	w.raddrs[0] = l.LocalAddr().String()
+	w.current = 1
+	w.checked = time.Now().Add(-w.recheck)
+
+	if err = w.Log(time.Now(), LOG_INFO, "m"); err != nil {
+		t.Fatal(err)
+	}
+	if w.current != 1 || len(secondary.Writes()) != 1 {
+		t.Errorf("got current %d, want datagram writer to stay on secondary", w.current)
+	}
+}
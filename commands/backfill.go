@@ -0,0 +1,321 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+// Backfill of an explicit date range walking slices in batches. Progress is kept in a state file of its own to resume
+// after interruption or failed delivery, the checkpoint of incremental syncs is neither read nor advanced
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/urfave/cli/v2"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var errInterrupted = errors.New("backfill interrupted, run same command to resume")
+
+// CmdBackfill ...
+type CmdBackfill struct {
+	CmdRun
+}
+
+// backfillState holds progress of a backfill to resume after interruption
+type backfillState struct {
+	From  string           `json:"from"`
+	To    string           `json:"to"`
+	Slice string           `json:"slice"`
+	Done  map[string]int64 `json:"done"` // unix ms up to which slices are reported per source
+}
+
+// newCmdBackfill returns command to report events of an explicit date range
+func newCmdBackfill() *cli.Command {
+
+	cmd := &CmdBackfill{
+		CmdRun: CmdRun{
+			command: command{
+				args: []cliArg{},
+			},
+		},
+	}
+
+	return &cli.Command{
+		Name:        "backfill",
+		Usage:       "report events of an explicit date range",
+		Description: "Report events of an explicit date range, i.e. to resend events after an outage",
+		Before:      cmd.bootstrap(cmd.setup),
+		Action:      cmd.action,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:      flagCfg,
+				Usage:     "use `FILE` as config",
+				Aliases:   []string{flagCfgAlias},
+				TakesFile: true,
+				Value:     "logsync.json",
+			},
+			&cli.StringFlag{
+				Name:  flagCfgFormat,
+				Usage: "read config as `FORMAT` (json, yaml or toml) instead of detecting it by file extension",
+			},
+			&cli.BoolFlag{
+				Name:    flagDryRun,
+				Usage:   "do not report to syslog server",
+				Aliases: []string{flagDryRunAlias},
+			},
+			&cli.StringFlag{
+				Name:     flagFrom,
+				Usage:    "first `DATE` (2006-01-02) to report",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     flagTo,
+				Usage:    "last `DATE` (2006-01-02) to report",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  flagSlice,
+				Usage: "fetch range in `SIZE` slices, only day is supported (default: filter.slice or day)",
+			},
+			&cli.IntFlag{
+				Name:  flagWorkers,
+				Usage: "fetch `N` slices at once (default: filter.workers or 4)",
+			},
+			&cli.Float64Flag{
+				Name:  flagRate,
+				Usage: "send at most `N` requests per second to the API, 0 if unlimited",
+			},
+			&cli.StringFlag{
+				Name:      flagState,
+				Usage:     "keep progress in `FILE` to resume after interruption",
+				TakesFile: true,
+				Value:     "logsync.backfill.json",
+			},
+		},
+	}
+}
+
+// action reports events of all sources slice by slice
+func (cmd *CmdBackfill) action(c *cli.Context) error {
+
+	defer cmd.close()
+
+	log.Printf("Starting %s %s backfill\n", c.App.Name, c.App.Version)
+
+	from, to, err := backfillRange(c.String(flagFrom), c.String(flagTo))
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	size := c.String(flagSlice)
+	if size == "" {
+		size = cmd.cfg.Filter.Slice
+	}
+	if size == "" {
+		size = api.SliceDay
+	}
+	workers := c.Int(flagWorkers)
+	if workers <= 0 {
+		workers = cmd.cfg.Filter.Workers
+	}
+	if workers <= 0 {
+		workers = api.SliceWorkersDefault
+	}
+	dryRun := c.Bool(flagDryRun)
+	path := c.String(flagState)
+
+	log.Printf("[Option] dryRun: %v\n", dryRun)
+	log.Printf("[Option] range: %s - %s\n", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	log.Printf("[Option] slice: %s; workers: %d; rate: %v\n", size, workers, c.Float64(flagRate))
+
+	slices, err := api.Slices(from, to, size)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	state, err := loadBackfillState(path, c.String(flagFrom), c.String(flagTo), size)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+
+	for _, a := range cmd.apis {
+		a.SetRateLimit(c.Float64(flagRate))
+	}
+
+	// waits for rate limit and Retry-After as well as outputs blocking on a full queue give up on stop
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		select {
+		case s := <-stop:
+			log.Printf("Received %s\n", s)
+			cmd.cancel()
+		case <-cmd.ctx.Done():
+		}
+	}()
+
+	for _, src := range cmd.cfg.Sources {
+		err = cmd.backfillSource(src.Name, slices, workers, state, path, dryRun)
+		if err != nil {
+			log.Println(err.Error())
+			return cli.Exit(err.Error(), 1)
+		}
+	}
+
+	if !dryRun {
+		if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[Backfill] %s\n", err.Error())
+		}
+	}
+	log.Println("Backfill complete")
+
+	return nil
+}
+
+// backfillSource reports events of slices not done yet in batches of workers slices. State is saved after each batch
+// delivered or spooled completely, the backfill fails otherwise
+func (cmd *CmdBackfill) backfillSource(source string, slices []api.Slice, workers int, state *backfillState, path string, dryRun bool) error {
+
+	todo := pendingSlices(slices, state.Done[source])
+	done := len(slices) - len(todo)
+	if done > 0 {
+		log.Printf("[Backfill] [%s] resuming after %d of %d slice(s)\n", source, done, len(slices))
+	}
+
+	values := cmd.values()
+
+	for len(todo) > 0 {
+		if cmd.ctx.Err() != nil {
+			return errInterrupted
+		}
+
+		n := workers
+		if n > len(todo) {
+			n = len(todo)
+		}
+		batch := todo[:n]
+		todo = todo[n:]
+
+		events, err := cmd.apis[source].QuerySlices(values, batch, workers)
+		if cmd.ctx.Err() != nil {
+			return errInterrupted
+		}
+		if err != nil {
+			return fmt.Errorf("[Backfill] [%s] %w", source, err)
+		}
+		events = cmd.filterReauth(events)
+
+		cmd.unsent = map[string]map[string]bool{}
+		var reported int
+		for _, ev := range events {
+			reported += cmd.report(ev, source, dryRun)
+		}
+		cmd.flush()
+
+		done += n
+		log.Printf("[Backfill] [%s] %s - %s: %d event(s), reported %d (%d/%d slices, %d%%)\n",
+			source, batch[0], batch[n-1], len(events), reported, done, len(slices), done*100/len(slices))
+
+		if dryRun {
+			continue
+		}
+		if unsent := len(cmd.unsent[source]); unsent > 0 {
+			if cmd.ctx.Err() != nil {
+				return errInterrupted
+			}
+			return fmt.Errorf("[Backfill] [%s] %d event(s) neither delivered nor spooled, run same command to resume",
+				source, unsent)
+		}
+		state.Done[source] = batch[n-1].To.UnixMilli()
+		if err = state.save(path); err != nil {
+			return fmt.Errorf("[Backfill] state: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// pendingSlices returns slices starting at or after done (unix ms), i.e. not reported by an interrupted backfill
+func pendingSlices(slices []api.Slice, done int64) []api.Slice {
+	var todo []api.Slice
+	for _, s := range slices {
+		if s.From.UnixMilli() >= done {
+			todo = append(todo, s)
+		}
+	}
+	return todo
+}
+
+// backfillRange returns time range from start of first to end of last date, at most until now
+func backfillRange(first, last string) (time.Time, time.Time, error) {
+	from, err := time.ParseInLocation(api.EventDateLayout, first, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s: %w", flagFrom, err)
+	}
+	to, err := time.ParseInLocation(api.EventDateLayout, last, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s: %w", flagTo, err)
+	}
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s before %s", flagTo, flagFrom)
+	}
+	to = to.AddDate(0, 0, 1)
+	if now := time.Now(); to.After(now) {
+		to = now
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%s in the future", flagFrom)
+	}
+	return from, to, nil
+}
+
+// loadBackfillState reads state of backfill from path. New state is returned if file not exists. State of another
+// range or slice size is rejected
+func loadBackfillState(path, from, to, size string) (*backfillState, error) {
+	state := &backfillState{From: from, To: to, Slice: size, Done: map[string]int64{}}
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prev := new(backfillState)
+	if err = json.Unmarshal(bs, prev); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if prev.From != from || prev.To != to || prev.Slice != size {
+		return nil, fmt.Errorf("%s belongs to backfill %s - %s (%s), remove it or use another --%s",
+			path, prev.From, prev.To, prev.Slice, flagState)
+	}
+	if prev.Done == nil {
+		prev.Done = map[string]int64{}
+	}
+	return prev, nil
+}
+
+// save writes state to path atomically
+func (s *backfillState) save(path string) error {
+	bs, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, bs)
+}
@@ -0,0 +1,184 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/swisslearninghub/logsync/config"
+	"github.com/swisslearninghub/logsync/output"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackfillRange(t *testing.T) {
+	from, to, err := backfillRange("2023-05-30", "2023-06-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFrom := time.Date(2023, 5, 30, 0, 0, 0, 0, time.Local)
+	wantTo := time.Date(2023, 6, 2, 0, 0, 0, 0, time.Local)
+	if !from.Equal(wantFrom) || !to.Equal(wantTo) {
+		t.Errorf("got %s - %s, want %s - %s", from, to, wantFrom, wantTo)
+	}
+
+	today := time.Now().Format(api.EventDateLayout)
+	if _, to, err = backfillRange(today, today); err != nil || to.After(time.Now()) {
+		t.Errorf("today: got end %s, %v, want end not after now", to, err)
+	}
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(api.EventDateLayout)
+	for _, tt := range [][2]string{
+		{"2023-06-02", "2023-06-01"},
+		{"2023-06-01", "06/02/2023"},
+		{"yesterday", "2023-06-01"},
+		{tomorrow, tomorrow},
+	} {
+		if _, _, err = backfillRange(tt[0], tt[1]); err == nil {
+			t.Errorf("%s - %s accepted", tt[0], tt[1])
+		}
+	}
+}
+
+func TestLoadBackfillState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "backfill.json")
+
+	state, err := loadBackfillState(path, "2023-06-01", "2023-06-02", api.SliceDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Done) != 0 {
+		t.Errorf("new state: got %v, want none done", state.Done)
+	}
+
+	state.Done["a"] = 42
+	if err = state.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if state, err = loadBackfillState(path, "2023-06-01", "2023-06-02", api.SliceDay); err != nil {
+		t.Fatal(err)
+	}
+	if state.Done["a"] != 42 {
+		t.Errorf("resumed state: got %v, want a done up to 42", state.Done)
+	}
+
+	if _, err = loadBackfillState(path, "2023-06-01", "2023-06-03", api.SliceDay); err == nil {
+		t.Error("state of another range accepted")
+	}
+}
+
+func TestPendingSlices(t *testing.T) {
+	from := time.Date(2023, 6, 1, 0, 0, 0, 0, time.Local)
+	slices, err := api.Slices(from, from.AddDate(0, 0, 4), api.SliceDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if todo := pendingSlices(slices, 0); len(todo) != 4 {
+		t.Errorf("new backfill: got %d slices, want 4", len(todo))
+	}
+	todo := pendingSlices(slices, slices[1].To.UnixMilli())
+	if len(todo) != 2 || !todo[0].From.Equal(slices[2].From) {
+		t.Errorf("resumed after 2 slices: got %v, want from %s", todo, slices[2])
+	}
+	if todo = pendingSlices(slices, slices[3].To.UnixMilli()); len(todo) != 0 {
+		t.Errorf("completed backfill: got %v, want none", todo)
+	}
+}
+
+// testSink records sent records or fails with err
+type testSink struct {
+	sent []*output.Record
+	err  error
+}
+
+// Send match interface
+func (s *testSink) Send(rec *output.Record) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.sent = append(s.sent, rec)
+	return nil
+}
+
+// Close match interface
+func (s *testSink) Close() error {
+	return nil
+}
+
+func TestBackfillUndelivered(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/token" {
+			_, _ = w.Write([]byte(`{"access_token":"tok","token_type":"bearer","expires_in":300}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `[{"time":%d,"type":"LOGOUT","userId":"u"}]`, time.Now().UnixMilli())
+	}))
+	defer server.Close()
+
+	cfg, err := config.NewFromBytes([]byte(fmt.Sprintf(`{
+		"outputs": [{"name": "out", "type": "file", "file": {"path": "-"}}],
+		"oauth2": {"client_id": "c", "secret": "s", "token_url": "%[1]s/token", "context_url": "%[1]s"},
+		"filter": {"days": 1, "max": 100},
+		"detections": [{"class_id": "1", "name": "Logout", "reporters": [{"type": "type", "config": {"type": "LOGOUT"}}]}]
+	}`, server.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := api.NewAPI("c", "s", server.URL+"/token", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &testSink{err: errors.New("unreachable")}
+	cmd := &CmdBackfill{CmdRun: CmdRun{
+		ctx:   context.Background(),
+		cfg:   cfg,
+		apis:  map[string]*api.HubAPI{config.SourceDefault: a},
+		sinks: map[string]output.Sink{"out": sink},
+	}}
+
+	from := time.Now().AddDate(0, 0, -1)
+	slices, err := api.Slices(from, time.Now(), api.SliceDay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "backfill.json")
+	state := &backfillState{Done: map[string]int64{}}
+
+	if err = cmd.backfillSource(config.SourceDefault, slices, 1, state, path, false); err == nil {
+		t.Fatal("undelivered events not reported as failure")
+	}
+	if len(state.Done) != 0 {
+		t.Errorf("progress saved despite undelivered events: %v", state.Done)
+	}
+	if _, err = os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("state file written: %v", err)
+	}
+
+	sink.err = nil
+	if err = cmd.backfillSource(config.SourceDefault, slices, 1, state, path, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.sent) == 0 || state.Done[config.SourceDefault] != slices[len(slices)-1].To.UnixMilli() {
+		t.Errorf("got %d sent, done %v", len(sink.sent), state.Done)
+	}
+}
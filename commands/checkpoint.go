@@ -0,0 +1,174 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/swisslearninghub/logsync/config"
+	"os"
+	"path/filepath"
+)
+
+const checkpointPerm = 0600
+
+// checkpoint holds progress of incremental syncs per source
+type checkpoint struct {
+	Time    int64                `json:"time,omitempty"` // default source of checkpoints written by former versions
+	Sources map[string]*position `json:"sources,omitempty"`
+}
+
+// position is the progress of a source. Events before Time are handled, events at Time if their key is in Seen
+type position struct {
+	Time int64    `json:"time"`
+	Seen []string `json:"seen"`
+}
+
+// UnmarshalJSON accepts time of latest handled event as written by former versions
+func (p *position) UnmarshalJSON(bs []byte) error {
+	var t int64
+	if err := json.Unmarshal(bs, &t); err == nil {
+		*p = position{Time: t + 1}
+		return nil
+	}
+	type plain position
+	return json.Unmarshal(bs, (*plain)(p))
+}
+
+// loadCheckpoint reads checkpoint from path. Zero checkpoint is returned if file not exists
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := new(checkpoint)
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(bs, cp); err != nil {
+		return nil, err
+	}
+	if cp.Time > 0 {
+		if cp.get(config.SourceDefault).Time == 0 {
+			cp.set(config.SourceDefault, position{Time: cp.Time + 1})
+		}
+		cp.Time = 0
+	}
+	return cp, nil
+}
+
+// get returns position of source
+func (cp *checkpoint) get(source string) position {
+	if p, ok := cp.Sources[source]; ok {
+		return *p
+	}
+	return position{}
+}
+
+// set sets position of source
+func (cp *checkpoint) set(source string, p position) {
+	if cp.Sources == nil {
+		cp.Sources = map[string]*position{}
+	}
+	cp.Sources[source] = &p
+}
+
+// handled returns true if ev was handled by a previous sync
+func (p position) handled(ev *api.EventRepresentation) bool {
+	if ev.Time != p.Time {
+		return ev.Time < p.Time
+	}
+	key := eventKey(ev)
+	for _, k := range p.Seen {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// advance returns position after events were handled. It does not pass the earliest event for which unsent returns
+// true, so the event is fetched again by the next sync
+func (p position) advance(events []api.EventRepresentation, unsent func(ev *api.EventRepresentation) bool) position {
+	next := p
+	blocked := false
+	for i := range events {
+		ev := &events[i]
+		if unsent(ev) {
+			if !blocked || ev.Time < next.Time {
+				next.Time = ev.Time
+			}
+			blocked = true
+			continue
+		}
+		if !blocked && ev.Time > next.Time {
+			next.Time = ev.Time
+		}
+	}
+	if next.Time < p.Time {
+		return p
+	}
+	next.Seen = nil
+	if next.Time == p.Time {
+		next.Seen = append(next.Seen, p.Seen...)
+	}
+	for i := range events {
+		if ev := &events[i]; ev.Time == next.Time && !unsent(ev) {
+			next.Seen = append(next.Seen, eventKey(ev))
+		}
+	}
+	return next
+}
+
+// eventKey returns fingerprint of ev to tell apart events of the same millisecond
+func eventKey(ev *api.EventRepresentation) string {
+	bs, _ := json.Marshal(ev)
+	sum := sha256.Sum256(bs)
+	return hex.EncodeToString(sum[:8])
+}
+
+// save writes checkpoint to path atomically
+func (cp *checkpoint) save(path string) error {
+	bs, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, bs)
+}
+
+// writeFileAtomic writes bs to a temporary file renamed to path
+func writeFileAtomic(path string, bs []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err = tmp.Write(bs); err == nil {
+		err = tmp.Sync()
+	}
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), checkpointPerm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
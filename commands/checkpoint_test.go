@@ -0,0 +1,104 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/swisslearninghub/logsync/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testEvent returns event of user at t
+func testEvent(t int64, user string) api.EventRepresentation {
+	return api.EventRepresentation{Time: t, UserID: &user}
+}
+
+// none reports no event as unsent
+func none(*api.EventRepresentation) bool { return false }
+
+func TestPositionSameMillisecond(t *testing.T) {
+	a, b, c := testEvent(100, "a"), testEvent(100, "b"), testEvent(99, "c")
+
+	pos := position{}.advance([]api.EventRepresentation{a, c}, none)
+	if pos.Time != 100 || len(pos.Seen) != 1 {
+		t.Fatalf("position: got %+v, want time 100 with 1 seen event", pos)
+	}
+	if !pos.handled(&a) || !pos.handled(&c) {
+		t.Error("reported events not handled")
+	}
+	if pos.handled(&b) {
+		t.Error("late event of same millisecond handled")
+	}
+
+	pos = pos.advance([]api.EventRepresentation{b}, none)
+	if pos.Time != 100 || len(pos.Seen) != 2 || !pos.handled(&a) || !pos.handled(&b) {
+		t.Errorf("position after late event: got %+v", pos)
+	}
+}
+
+func TestPositionUnsent(t *testing.T) {
+	events := []api.EventRepresentation{testEvent(300, "a"), testEvent(100, "b"), testEvent(200, "c"), testEvent(200, "d")}
+	unsent := func(ev *api.EventRepresentation) bool { return *ev.UserID == "c" }
+
+	pos := position{Time: 50}.advance(events, unsent)
+	if pos.Time != 200 {
+		t.Fatalf("time: got %d, want 200", pos.Time)
+	}
+	want := map[string]bool{"a": false, "b": true, "c": false, "d": true}
+	for i := range events {
+		if got := pos.handled(&events[i]); got != want[*events[i].UserID] {
+			t.Errorf("event %s: handled %v, want %v", *events[i].UserID, got, !got)
+		}
+	}
+
+	all := func(*api.EventRepresentation) bool { return true }
+	if got := pos.advance(events[2:3], all); got.Time != pos.Time || len(got.Seen) != len(pos.Seen) {
+		t.Errorf("position moved without delivered events: got %+v, want %+v", got, pos)
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := os.WriteFile(path, []byte(`{"time":100,"sources":{"b":200}}`), checkpointPerm); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, late := testEvent(100, "a"), testEvent(101, "a")
+	if pos := cp.get(config.SourceDefault); !pos.handled(&old) || pos.handled(&late) {
+		t.Errorf("default source: got %+v", pos)
+	}
+	if pos := cp.get("b"); pos.Time != 201 {
+		t.Errorf("source b: got %+v, want time 201", pos)
+	}
+
+	cp.set("b", position{}.advance([]api.EventRepresentation{late}, none))
+	if err = cp.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if cp, err = loadCheckpoint(path); err != nil {
+		t.Fatal(err)
+	}
+	if pos := cp.get("b"); !pos.handled(&late) || pos.Time != 101 {
+		t.Errorf("source b after save: got %+v", pos)
+	}
+	if pos := cp.get(config.SourceDefault); pos.Time != 101 {
+		t.Errorf("default source after save: got %+v", pos)
+	}
+}
@@ -16,14 +16,27 @@ package commands
 
 import (
 	"fmt"
+	"github.com/swisslearninghub/logsync/config"
 	"github.com/urfave/cli/v2"
+	"os"
+	"path/filepath"
 )
 
 const (
-	flagCfg         = "config"
-	flagCfgAlias    = "c"
-	flagDryRun      = "dry-run"
-	flagDryRunAlias = "d"
+	flagCfg           = "config"
+	flagCfgAlias      = "c"
+	flagCfgFormat     = "config-format"
+	flagDryRun        = "dry-run"
+	flagDryRunAlias   = "d"
+	flagInterval      = "interval"
+	flagIntervalAlias = "i"
+	flagWatch         = "watch"
+	flagFrom          = "from"
+	flagTo            = "to"
+	flagSlice         = "slice"
+	flagWorkers       = "workers"
+	flagRate          = "rate"
+	flagState         = "state"
 )
 
 // Run is the app starter
@@ -35,6 +48,9 @@ func Run(args []string) error {
 	app.Copyright = "Swiss Learning Hub AG"
 	app.Commands = []*cli.Command{
 		newCmdRun(),
+		newCmdBackfill(),
+		newCmdSpool(),
+		newCmdSchema(),
 	}
 	return app.Run(args)
 }
@@ -81,3 +97,28 @@ func (cmd *command) bootstrapArgs(c *cli.Context) error {
 
 	return nil
 }
+
+// loadConfig loads configuration from flag or default locations
+func loadConfig(c *cli.Context) (*config.Config, error) {
+
+	var app string
+	var cwd string
+	var err error
+
+	if cwd, err = os.Getwd(); err != nil {
+		return nil, err
+	}
+
+	if app, err = filepath.Abs(os.Args[0]); err != nil {
+		return nil, err
+	}
+
+	paths := []string{c.String(flagCfg)}
+	for _, dir := range []string{cwd, filepath.Dir(app)} {
+		for _, ext := range config.FileExtensions {
+			paths = append(paths, filepath.Join(dir, "logsync"+ext))
+		}
+	}
+
+	return config.NewFromFilesFormat(c.String(flagCfgFormat), paths...)
+}
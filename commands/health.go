@@ -0,0 +1,149 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/swisslearninghub/logsync/config"
+	"github.com/swisslearninghub/logsync/output"
+	"net/http"
+	"time"
+)
+
+// Health status
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+// syncAgeFactor times interval is the default maximum age of last successful sync
+const syncAgeFactor = 3
+
+// health is the response of health endpoints
+type health struct {
+	Status     string                `json:"status"`
+	Components map[string]*component `json:"components"`
+}
+
+// component is the status of a single component
+type component struct {
+	Status  string      `json:"status"`
+	Error   string      `json:"error,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// add sets status of component by err
+func (h *health) add(name string, details interface{}, err error) {
+	c := &component{Status: statusOK, Details: details}
+	if err != nil {
+		c.Status = statusFail
+		c.Error = err.Error()
+		h.Status = statusFail
+	}
+	h.Components[name] = c
+}
+
+// write responds with JSON and 503 if any component failed
+func (h *health) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	if h.Status != statusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(h)
+}
+
+// healthz reports liveness, i.e. whether syncs of any source keep succeeding
+func (cmd *CmdRun) healthz(w http.ResponseWriter, _ *http.Request) {
+	h := &health{Status: statusOK, Components: map[string]*component{}}
+	var last time.Time
+	for _, src := range cmd.cfg.Sources {
+		if t := cmd.lastSync(src.Name); t.After(last) {
+			last = t
+		}
+	}
+	cmd.checkSync(h, "sync", last, false)
+	h.write(w)
+}
+
+// readyz reports readiness of tokens, outputs, syncs per source and spool
+func (cmd *CmdRun) readyz(w http.ResponseWriter, _ *http.Request) {
+	h := &health{Status: statusOK, Components: map[string]*component{}}
+
+	for _, src := range cmd.cfg.Sources {
+		expiry, err := cmd.apis[src.Name].TokenState()
+		h.add(sourceComponent("token", src.Name), map[string]interface{}{"expiry": expiry}, err)
+		cmd.checkSync(h, sourceComponent("sync", src.Name), cmd.lastSync(src.Name), true)
+	}
+
+	for _, o := range cmd.cfg.Outputs {
+		if c, ok := cmd.sinks[o.Name].(output.Checker); ok {
+			h.add("output:"+o.Name, nil, c.Check())
+		}
+	}
+
+	if cmd.spool != nil {
+		records, size, err := cmd.spool.Size()
+		h.add("spool", map[string]interface{}{"records": records, "bytes": size}, err)
+	}
+
+	h.write(w)
+}
+
+// sourceComponent returns name of component of source, further sources are suffixed by name
+func sourceComponent(name, source string) string {
+	if source == config.SourceDefault {
+		return name
+	}
+	return name + ":" + source
+}
+
+// checkSync adds status of last successful sync as component name. Without a sync yet age is measured from start,
+// unless required
+func (cmd *CmdRun) checkSync(h *health, name string, last time.Time, required bool) {
+	var err error
+	details := map[string]interface{}{}
+	since := last
+	if last.IsZero() {
+		since = cmd.started
+		if required {
+			err = errors.New("no successful sync yet")
+		}
+	} else {
+		details["last_sync"] = last
+	}
+	age := time.Since(since)
+	details["age_seconds"] = int64(age.Seconds())
+	if maxAge := cmd.maxSyncAge(); maxAge > 0 && age > maxAge {
+		err = fmt.Errorf("no successful sync for %s", age.Truncate(time.Second))
+	}
+	h.add(name, details, err)
+}
+
+// maxSyncAge returns configured maximum age of last successful sync, defaults to a multiple of interval
+func (cmd *CmdRun) maxSyncAge() time.Duration {
+	if cmd.cfg.HTTP.MaxSyncAge > 0 {
+		return time.Duration(cmd.cfg.HTTP.MaxSyncAge) * time.Second
+	}
+	return cmd.interval * syncAgeFactor
+}
+
+// lastSync returns time of last successful sync of source, zero if none
+func (cmd *CmdRun) lastSync(source string) time.Time {
+	cmd.syncMu.Lock()
+	defer cmd.syncMu.Unlock()
+	return cmd.synced[source]
+}
@@ -0,0 +1,75 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/swisslearninghub/logsync/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// probe returns status code and components of health endpoint
+func probe(t *testing.T, handler http.HandlerFunc) (int, map[string]*component) {
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	h := new(health)
+	if err := json.Unmarshal(rec.Body.Bytes(), h); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, h.Components
+}
+
+func TestSyncPerSource(t *testing.T) {
+	cmd := &CmdRun{
+		cfg:      &config.Config{Sources: []config.Source{{Name: config.SourceDefault}, {Name: "b"}}},
+		apis:     map[string]*api.HubAPI{},
+		interval: time.Minute,
+		started:  time.Now().Add(-time.Hour),
+	}
+	if err := json.Unmarshal([]byte(`{"http":{"listen":"localhost:0"}}`), cmd.cfg); err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range cmd.cfg.Sources {
+		a, err := api.NewAPI("id", "secret", "http://localhost/token", "http://localhost")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cmd.apis[src.Name] = a
+	}
+	cmd.setSynced("b", time.Now())
+
+	code, components := probe(t, cmd.healthz)
+	if code != http.StatusOK || components["sync"].Status != statusOK {
+		t.Errorf("healthz: got %d %+v, want ok while a source syncs", code, components["sync"])
+	}
+
+	code, components = probe(t, cmd.readyz)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("readyz: got %d, want %d", code, http.StatusServiceUnavailable)
+	}
+	if c := components["sync"]; c == nil || c.Status != statusFail {
+		t.Errorf("sync of default source: got %+v, want failure", c)
+	}
+	if c := components["sync:b"]; c == nil || c.Status != statusOK {
+		t.Errorf("sync of source b: got %+v, want ok", c)
+	}
+	if c := components["token:b"]; c == nil || c.Status != statusFail {
+		t.Errorf("token of source b: got %+v, want failure without token request", c)
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"fmt"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"github.com/swisslearninghub/logsync/config"
+	"github.com/swisslearninghub/logsync/output"
+	"log"
+	"time"
+)
+
+const fileSizeUnit = 1 << 20
+
+// newSink returns output.Sink for given output configuration. Sends blocking on full queues give up once ctx is done
+func newSink(ctx context.Context, o config.Output) (output.Sink, error) {
+	switch o.Type {
+	case config.OutputSyslog:
+		return newSyslogSink(ctx, o.Syslog)
+	case config.OutputFile:
+		return newFileSink(o.File)
+	case config.OutputGELF:
+		return newGELFSink(o.GELF)
+	case config.OutputWebhook:
+		return newWebhookSink(ctx, o.Webhook)
+	case config.OutputHEC:
+		return newHECSink(ctx, o.HEC)
+	case config.OutputKafka:
+		return newKafkaSink(o.Kafka)
+	default:
+		return nil, fmt.Errorf("unknown output type: %s", o.Type)
+	}
+}
+
+// newSyslogSink initializes syslog client
+func newSyslogSink(ctx context.Context, cfg *config.Syslog) (output.Sink, error) {
+	format, err := output.NewFormatter(cfg.Format.Type, cfg.Format.Config)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Proto == config.SyslogJournald {
+		var path string
+		if addrs := cfg.AllAddresses(); len(addrs) > 0 {
+			path = addrs[0]
+		}
+		return output.NewJournaldSink(path, cfg.Tag, cfg.Facility, format)
+	}
+	network := cfg.Proto
+	if network == config.SyslogLocal {
+		network = ""
+	}
+	w, err := cefsyslog.SyslogWriterDialMulti(
+		network,
+		cfg.AllAddresses(),
+		cfg.Mode,
+		time.Duration(cfg.Recheck)*time.Second,
+		cfg.Facility,
+		cfg.Tag,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err = w.SetMaxSize(cfg.MaxSize, cfg.Oversize); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	if cfg.Async != nil {
+		w.StartAsync(cefsyslog.AsyncOptions{
+			QueueSize:     cfg.Async.QueueSize,
+			BatchSize:     cfg.Async.BatchSize,
+			FlushInterval: time.Duration(cfg.Async.FlushInterval) * time.Second,
+			Drop:          cfg.Async.WhenFull == "drop",
+			Context:       ctx,
+			OnError: func(err error) {
+				log.Printf("[Syslog] %s\n", err.Error())
+			},
+		})
+	}
+	return output.NewSyslogSink(w, format, cfg.Truncate), nil
+}
+
+// newFileSink initializes file output
+func newFileSink(cfg *config.File) (output.Sink, error) {
+	format, err := output.NewFormatter(cfg.Format.Type, cfg.Format.Config)
+	if err != nil {
+		return nil, err
+	}
+	opts := output.FileOptions{
+		Sync: cfg.Sync,
+		OnError: func(err error) {
+			log.Printf("[File] %s\n", err.Error())
+		},
+	}
+	if cfg.Rotate != nil {
+		opts.MaxSize = int64(cfg.Rotate.MaxSize) * fileSizeUnit
+		opts.Interval = time.Duration(cfg.Rotate.Interval) * time.Hour
+		opts.MaxFiles = cfg.Rotate.MaxFiles
+		opts.Compress = cfg.Rotate.Compress
+	}
+	return output.NewFileSink(cfg.Path, format, opts)
+}
+
+// newGELFSink initializes GELF output
+func newGELFSink(cfg *config.GELF) (output.Sink, error) {
+	return output.NewGELFSink(
+		cfg.Proto,
+		cfg.Address,
+		cfg.Host,
+		cfg.Compression,
+		cfg.ChunkSize,
+	)
+}
+
+// newWebhookSink initializes HTTP webhook output
+func newWebhookSink(ctx context.Context, cfg *config.Webhook) (output.Sink, error) {
+	formatType := cfg.Format.Type
+	if formatType == "" {
+		formatType = output.FormatJSON
+	}
+	format, err := output.NewFormatter(formatType, cfg.Format.Config)
+	if err != nil {
+		return nil, err
+	}
+	return output.NewWebhookSink(output.WebhookOptions{
+		URL:             cfg.URL,
+		Method:          cfg.Method,
+		Headers:         cfg.Headers,
+		Secret:          cfg.Secret,
+		SignatureHeader: cfg.SignatureHeader,
+		Timeout:         time.Duration(cfg.Timeout) * time.Second,
+		Retries:         cfg.Retries,
+		RetryWait:       time.Duration(cfg.RetryWait) * time.Second,
+		BatchSize:       cfg.BatchSize,
+		Template:        cfg.Template,
+		ContentType:     cfg.ContentType,
+		Context:         ctx,
+	}, format)
+}
+
+// newHECSink initializes Splunk HTTP Event Collector output
+func newHECSink(ctx context.Context, cfg *config.HEC) (output.Sink, error) {
+	formatType := cfg.Format.Type
+	if formatType == "" {
+		formatType = output.FormatJSON
+	}
+	format, err := output.NewFormatter(formatType, cfg.Format.Config)
+	if err != nil {
+		return nil, err
+	}
+	return output.NewHECSink(output.HECOptions{
+		URL:         cfg.URL,
+		Token:       cfg.Token,
+		Index:       cfg.Index,
+		Sourcetype:  cfg.Sourcetype,
+		Source:      cfg.Source,
+		Host:        cfg.Host,
+		BatchSize:   cfg.BatchSize,
+		Ack:         cfg.Ack,
+		AckTimeout:  time.Duration(cfg.AckTimeout) * time.Second,
+		AckInterval: time.Duration(cfg.AckInterval) * time.Second,
+		Channel:     cfg.Channel,
+		Timeout:     time.Duration(cfg.Timeout) * time.Second,
+		Retries:     cfg.Retries,
+		RetryWait:   time.Duration(cfg.RetryWait) * time.Second,
+		Context:     ctx,
+	}, format)
+}
+
+// newKafkaSink initializes Kafka producer output
+func newKafkaSink(cfg *config.Kafka) (output.Sink, error) {
+	formatType := cfg.Format.Type
+	if formatType == "" {
+		formatType = output.FormatJSON
+	}
+	format, err := output.NewFormatter(formatType, cfg.Format.Config)
+	if err != nil {
+		return nil, err
+	}
+	opts := output.KafkaOptions{
+		Brokers:     cfg.Brokers,
+		Topic:       cfg.Topic,
+		Key:         cfg.Key,
+		Compression: cfg.Compression,
+		Acks:        cfg.Acks,
+		BatchSize:   cfg.BatchSize,
+		Timeout:     time.Duration(cfg.Timeout) * time.Second,
+	}
+	if cfg.SASL != nil {
+		opts.SASLMechanism = cfg.SASL.Mechanism
+		opts.SASLUsername = cfg.SASL.Username
+		opts.SASLPassword = cfg.SASL.Password
+	}
+	if cfg.TLS != nil {
+		opts.TLS = true
+		opts.TLSCAFile = cfg.TLS.CAFile
+		opts.TLSCertFile = cfg.TLS.CertFile
+		opts.TLSKeyFile = cfg.TLS.KeyFile
+		opts.TLSInsecure = cfg.TLS.Insecure
+	}
+	return output.NewKafkaSink(opts, format)
+}
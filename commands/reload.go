@@ -0,0 +1,117 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+// Reload of detections on SIGHUP or changed configuration files. Reloads are handled between syncs, so a sync always
+// uses a single detection set
+
+import (
+	"fmt"
+	"github.com/swisslearninghub/logsync/config"
+	"github.com/swisslearninghub/logsync/metrics"
+	"log"
+	"os"
+	"strings"
+)
+
+// reload re-reads configuration and swaps detections if valid. Current detections are kept on error, other settings
+// require a restart
+func (cmd *CmdRun) reload() {
+	cfg, err := cmd.loadReload()
+	metrics.ObserveReload(err)
+	if err != nil {
+		// files are not checked again before they change
+		cmd.stamps = cmd.fileStamps()
+		log.Printf("[Reload] %s; keeping current detections\n", err.Error())
+		return
+	}
+
+	if keys := cmd.cfg.ChangedSettings(cfg); len(keys) > 0 {
+		log.Printf("[Reload] changed settings require a restart and are ignored: %s\n", strings.Join(keys, ", "))
+	}
+
+	added, removed, changed := config.DiffDetections(cmd.cfg.Detections, cfg.Detections)
+	cmd.cfg.ReplaceDetections(cfg)
+	cmd.stamps = cmd.fileStamps()
+
+	if len(added)+len(removed)+len(changed) == 0 {
+		log.Println("[Reload] detections unchanged")
+		return
+	}
+	log.Printf("[Reload] added: %s; removed: %s; changed: %s\n",
+		joinIDs(added), joinIDs(removed), joinIDs(changed))
+}
+
+// loadReload returns configuration read from file loaded at start. Detections must route to running outputs and
+// take global device fields from the running configuration, like other settings requiring a restart
+func (cmd *CmdRun) loadReload() (*config.Config, error) {
+	if cmd.cfg.Path() == "" {
+		return nil, fmt.Errorf("configuration not read from file")
+	}
+	cfg, err := config.NewFromFileFormat(cmd.cfg.Path(), cmd.cfgFormat)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cfg.Detections {
+		for _, name := range cfg.Detections[i].Outputs {
+			if _, ok := cmd.sinks[name]; !ok {
+				return nil, fmt.Errorf("detection %s: output %s not running, restart required", cfg.Detections[i].ClassID, name)
+			}
+		}
+	}
+	if err = cfg.PrepareDetections(cmd.cfg.Device); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// changed returns true if a configuration file was modified, added or removed since last (re)load
+func (cmd *CmdRun) changed() bool {
+	stamps := cmd.fileStamps()
+	if len(stamps) != len(cmd.stamps) {
+		return true
+	}
+	for file, stamp := range stamps {
+		if cmd.stamps[file] != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// fileStamps returns modification time and size per configuration file. Missing files have an empty stamp
+func (cmd *CmdRun) fileStamps() map[string]string {
+	files, err := cmd.cfg.Files()
+	if err != nil {
+		log.Printf("[Reload] %s\n", err.Error())
+	}
+	stamps := map[string]string{}
+	for _, file := range files {
+		if fi, err := os.Stat(file); err == nil {
+			stamps[file] = fmt.Sprintf("%d/%d", fi.ModTime().UnixNano(), fi.Size())
+			continue
+		}
+		stamps[file] = ""
+	}
+	return stamps
+}
+
+// joinIDs returns class IDs comma separated, - if none
+func joinIDs(ids []string) string {
+	if len(ids) == 0 {
+		return "-"
+	}
+	return strings.Join(ids, ", ")
+}
@@ -15,17 +15,26 @@
 package commands
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/swisslearninghub/logsync/api"
 	"github.com/swisslearninghub/logsync/cefsyslog"
 	"github.com/swisslearninghub/logsync/config"
+	"github.com/swisslearninghub/logsync/metrics"
+	"github.com/swisslearninghub/logsync/output"
+	"github.com/swisslearninghub/logsync/spool"
 	"github.com/urfave/cli/v2"
 	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
@@ -34,10 +43,24 @@ const logPerm = 0644
 // CmdRun ...
 type CmdRun struct {
 	command
-	cfg     *config.Config
-	api     *api.HubAPI
-	logfile *os.File
-	ceflog  *cefsyslog.Writer
+	ctx        context.Context // done on SIGINT or SIGTERM in daemon mode
+	cancel     context.CancelFunc
+	cfg        *config.Config
+	apis       map[string]*api.HubAPI // api per source
+	logfile    *os.File
+	sinks      map[string]output.Sink
+	spool      *spool.Spool
+	checkpoint *checkpoint
+	server     *http.Server
+	interval   time.Duration
+	started    time.Time
+	cfgFormat  string
+	watch      time.Duration
+	stamps     map[string]string                  // modification stamps of configuration files (see fileStamps)
+	pending    map[string]map[*output.Record]bool // records queued by buffering outputs per output
+	unsent     map[string]map[string]bool         // keys of events neither delivered nor spooled per source
+	syncMu     sync.Mutex                         // guards synced
+	synced     map[string]time.Time               // last successful sync per source
 }
 
 // newRealmPolicySetDefault ...
@@ -65,11 +88,24 @@ func newCmdRun() *cli.Command {
 				TakesFile: true,
 				Value:     "logsync.json",
 			},
+			&cli.StringFlag{
+				Name:  flagCfgFormat,
+				Usage: "read config as `FORMAT` (json, yaml or toml) instead of detecting it by file extension",
+			},
 			&cli.BoolFlag{
 				Name:    flagDryRun,
 				Usage:   "do not report to syslog server",
 				Aliases: []string{flagDryRunAlias},
 			},
+			&cli.IntFlag{
+				Name:    flagInterval,
+				Usage:   "keep running and sync every `SECONDS`, only events newer than the last sync are reported",
+				Aliases: []string{flagIntervalAlias},
+			},
+			&cli.IntFlag{
+				Name:  flagWatch,
+				Usage: "reload detections if configuration files changed, checked every `SECONDS` (with --interval only)",
+			},
 		},
 	}
 }
@@ -77,8 +113,26 @@ func newCmdRun() *cli.Command {
 // before bootstraps run
 func (cmd *CmdRun) before(c *cli.Context) error {
 
+	if err := cmd.setup(c); err != nil {
+		return err
+	}
+
+	if err := cmd.setCheckpoint(); err != nil {
+		log.Println(err.Error())
+		cmd.close()
+		return cli.Exit(err.Error(), 1)
+	}
+
+	return nil
+}
+
+// setup loads configuration and initializes logging, apis, outputs and spool
+func (cmd *CmdRun) setup(c *cli.Context) error {
+
 	var err error
 
+	cmd.ctx, cmd.cancel = context.WithCancel(context.Background())
+
 	if err = cmd.setConfig(c); err != nil {
 		return cli.Exit(err.Error(), 1)
 	}
@@ -87,13 +141,22 @@ func (cmd *CmdRun) before(c *cli.Context) error {
 		return cli.Exit(err.Error(), 1)
 	}
 
-	if err = cmd.setAPI(); err != nil {
+	if err = cmd.setAPIs(); err != nil {
+		log.Println(err.Error())
+		cmd.close()
+		return cli.Exit(err.Error(), 1)
+	}
+
+	if err = cmd.setOutputs(); err != nil {
 		log.Println(err.Error())
 		cmd.close()
 		return cli.Exit(err.Error(), 1)
 	}
 
-	if err = cmd.setSyslog(); err != nil {
+	if cmd.spool, err = openSpool(cmd.cfg); err == nil && cmd.spool != nil {
+		err = cmd.spool.Lock()
+	}
+	if err != nil {
 		log.Println(err.Error())
 		cmd.close()
 		return cli.Exit(err.Error(), 1)
@@ -109,46 +172,253 @@ func (cmd *CmdRun) action(c *cli.Context) error {
 
 	log.Printf("Starting %s %s\n", c.App.Name, c.App.Version)
 
-	log.Printf("[Option] dryRun: %v\n", c.Bool(flagDryRun))
+	dryRun := c.Bool(flagDryRun)
+	cmd.interval = time.Duration(c.Int(flagInterval)) * time.Second
+	cmd.watch = time.Duration(c.Int(flagWatch)) * time.Second
+	cmd.cfgFormat = c.String(flagCfgFormat)
+	cmd.started = time.Now()
+
+	log.Printf("[Option] dryRun: %v\n", dryRun)
+	log.Printf("[Option] interval: %v\n", cmd.interval)
+	log.Printf("[Option] watch: %v\n", cmd.watch)
+
+	if err := cmd.serve(); err != nil {
+		log.Println(err.Error())
+		log.Println("Exiting")
+		return cli.Exit(err.Error(), 1)
+	}
+
+	if cmd.interval <= 0 {
+		if err := cmd.sync(dryRun); err != nil {
+			log.Println(err.Error())
+			log.Println("Exiting")
+			return cli.Exit(err.Error(), 1)
+		}
+		log.Println("Exiting")
+		return nil
+	}
+
+	// stop is handled while syncing as well, so outputs blocking on a full queue give up
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	go func() {
+		select {
+		case s := <-stop:
+			log.Printf("Received %s\n", s)
+			cmd.cancel()
+		case <-cmd.ctx.Done():
+		}
+	}()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(cmd.interval)
+	defer ticker.Stop()
+
+	var watch <-chan time.Time
+	if cmd.watch > 0 {
+		cmd.stamps = cmd.fileStamps()
+		watcher := time.NewTicker(cmd.watch)
+		defer watcher.Stop()
+		watch = watcher.C
+	}
+
+	for {
+		if err := cmd.sync(dryRun); err != nil {
+			log.Println(err.Error())
+		}
+		if !cmd.wait(ticker.C, watch, hup) {
+			log.Println("Exiting")
+			return nil
+		}
+	}
+}
+
+// wait blocks until next sync is due, reloading detections on SIGHUP or changed configuration files meanwhile.
+// Returns false on SIGINT or SIGTERM
+func (cmd *CmdRun) wait(tick, watch <-chan time.Time, hup <-chan os.Signal) bool {
+	if cmd.ctx.Err() != nil {
+		return false
+	}
+	for {
+		select {
+		case <-tick:
+			return true
+		case <-watch:
+			if cmd.changed() {
+				log.Println("[Reload] configuration files changed")
+				cmd.reload()
+			}
+		case s := <-hup:
+			log.Printf("Received %s\n", s)
+			cmd.reload()
+		case <-cmd.ctx.Done():
+			return false
+		}
+	}
+}
+
+// sync replays spooled records, queries events of all sources and reports events newer than checkpoint of source
+func (cmd *CmdRun) sync(dryRun bool) error {
+
+	cmd.unsent = map[string]map[string]bool{}
+
+	if !dryRun {
+		cmd.replay()
+	}
 
 	values := cmd.values()
 	for k, v := range values {
 		log.Printf("[Query] %s: %v\n", k, v)
 	}
 
-	events, err := cmd.api.QueryClientEvents(values)
+	slices, err := cmd.slices()
 	if err != nil {
-		log.Println(err.Error())
-		log.Println("Exiting")
-		return cli.Exit(err.Error(), 1)
+		cmd.flush()
+		return err
+	}
+	if len(slices) > 0 {
+		log.Printf("[Query] slices: %d (%s)\n", len(slices), cmd.cfg.Filter.Slice)
 	}
 
-	log.Printf("Retrieved %d event(s)\n", len(events))
+	var all []api.EventRepresentation
+	var failed []string
+	var synced []fetched
+
+	for _, res := range cmd.fetch(values, slices) {
+		if res.err != nil {
+			log.Printf("[%s] %s\n", res.source, res.err.Error())
+			failed = append(failed, res.source)
+			continue
+		}
+		all = append(all, res.events...)
+		res.events = cmd.syncSource(res.source, res.events, dryRun)
+		synced = append(synced, res)
+	}
 
-	bs, _ := json.MarshalIndent(&events, "", "  ")
+	// records are only known to be delivered or spooled once buffering outputs are flushed
+	cmd.flush()
+
+	now := time.Now()
+	for _, res := range synced {
+		if !dryRun {
+			cmd.saveCheckpoint(res.source, res.events)
+		}
+		cmd.setSynced(res.source, now)
+	}
+
+	bs, _ := json.MarshalIndent(&all, "", "  ")
 	_ = os.WriteFile("temp.json", bs, logPerm)
 
-	log.Println("Internal prefiltering")
+	if len(failed) > 0 {
+		return fmt.Errorf("sync failed for source(s): %s", strings.Join(failed, ", "))
+	}
+
+	return nil
+}
 
-	events = cmd.filterReauth(events)
+// setSynced records time of last successful sync of source
+func (cmd *CmdRun) setSynced(source string, t time.Time) {
+	cmd.syncMu.Lock()
+	defer cmd.syncMu.Unlock()
+	if cmd.synced == nil {
+		cmd.synced = map[string]time.Time{}
+	}
+	cmd.synced[source] = t
+	metrics.SetLastSync(source, t)
+}
 
-	log.Printf("Iterating over %d event(s)\n", len(events))
+// fetched holds events queried from a source
+type fetched struct {
+	source string
+	events []api.EventRepresentation
+	err    error
+}
 
-	if len(events) == 0 {
-		log.Println("Exiting")
-		return nil
+// fetch queries all sources concurrently and returns results in order of sources. Slices of each source are fetched
+// by a pool of filter.workers
+func (cmd *CmdRun) fetch(values url.Values, slices []api.Slice) []fetched {
+	res := make([]fetched, len(cmd.cfg.Sources))
+	var wg sync.WaitGroup
+	for i, src := range cmd.cfg.Sources {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			var events []api.EventRepresentation
+			var err error
+			if len(slices) == 0 {
+				events, err = cmd.apis[name].QueryClientEvents(values)
+			} else {
+				events, err = cmd.apis[name].QuerySlices(values, slices, cmd.cfg.Filter.Workers)
+			}
+			res[i] = fetched{source: name, events: events, err: err}
+		}(i, src.Name)
 	}
+	wg.Wait()
+	return res
+}
+
+// syncSource reports events of source not handled by previous syncs and returns them
+func (cmd *CmdRun) syncSource(source string, events []api.EventRepresentation, dryRun bool) []api.EventRepresentation {
+
+	log.Printf("[%s] Retrieved %d event(s)\n", source, len(events))
+	metrics.EventsFetched.Add(float64(len(events)))
+
+	log.Printf("[%s] Internal prefiltering\n", source)
+
+	events = cmd.filterReauth(events)
+	metrics.EventsPrefiltered.Add(float64(len(events)))
+
+	events = cmd.filterCheckpoint(events, cmd.checkpoint.get(source))
+
+	log.Printf("[%s] Iterating over %d event(s)\n", source, len(events))
 
 	var reported int
 
 	for _, ev := range events {
-		reported += cmd.report(ev, c.Bool(flagDryRun))
+		reported += cmd.report(ev, source, dryRun)
 	}
 
-	log.Printf("Reported %d event(s)\n", reported)
-	log.Println("Exiting")
+	log.Printf("[%s] Reported %d event(s)\n", source, reported)
 
-	return nil
+	return events
+}
+
+// filterCheckpoint drops events handled by previous syncs
+func (cmd *CmdRun) filterCheckpoint(reps []api.EventRepresentation, pos position) []api.EventRepresentation {
+	var repsNew []api.EventRepresentation
+	for i := range reps {
+		if pos.handled(&reps[i]) {
+			continue
+		}
+		repsNew = append(repsNew, reps[i])
+	}
+	return repsNew
+}
+
+// saveCheckpoint advances checkpoint of source past events delivered or spooled and writes it to file if configured
+func (cmd *CmdRun) saveCheckpoint(source string, events []api.EventRepresentation) {
+	unsent := cmd.unsent[source]
+	prev := cmd.checkpoint.get(source)
+	next := prev.advance(events, func(ev *api.EventRepresentation) bool {
+		return unsent[eventKey(ev)]
+	})
+	if len(unsent) > 0 {
+		log.Printf("[%s] Checkpoint held back by %d undelivered event(s)\n", source, len(unsent))
+	}
+	if next.Time == prev.Time && len(next.Seen) == len(prev.Seen) {
+		return
+	}
+	cmd.checkpoint.set(source, next)
+	if cmd.cfg.Checkpoint == "" {
+		return
+	}
+	if err := cmd.checkpoint.save(cmd.cfg.Checkpoint); err != nil {
+		log.Printf("[Checkpoint] %s\n", err.Error())
+	}
 }
 
 // filterReauth drops any subsequent LOGINs (internal client reauth) for same sessionID
@@ -186,18 +456,26 @@ func (cmd *CmdRun) uniqueSess(reps []api.EventRepresentation) map[string]api.Eve
 }
 
 // report handles configured report checks and returns *CEF if needed. nil otherwise
-func (cmd *CmdRun) report(er api.EventRepresentation, dryRun bool) int {
+func (cmd *CmdRun) report(er api.EventRepresentation, source string, dryRun bool) int {
 	reported := 0
 	for _, detection := range cmd.cfg.Detections {
 		if detection.Report(&er) {
-			cef := detection.CEF()
-			cmd.updFromEvent(cef, &er)
+			metrics.Matches.WithLabelValues(detection.ClassID).Inc()
+			cef, err := detection.CEF(&er)
+			if err != nil {
+				log.Printf("[%d] %s\n", er.Time, err.Error())
+				continue
+			}
+			cmd.updFromEvent(cef, &er, source)
 			log.Printf("[%d] %s", er.Time, cef.String())
-			if !dryRun {
-				if err := cmd.ceflog.Log(time.UnixMilli(er.Time), detection.LogLevel, cef.String()); err != nil {
-					log.Printf("[%d] %s\n", er.Time, err.Error())
-					continue
-				}
+			if !dryRun && !cmd.send(&detection, &output.Record{
+				Time:     time.UnixMilli(er.Time),
+				LogLevel: detection.LogLevel,
+				CEF:      cef,
+				Event:    &er,
+				Source:   source,
+			}) {
+				continue
 			}
 			reported++
 		}
@@ -205,8 +483,125 @@ func (cmd *CmdRun) report(er api.EventRepresentation, dryRun bool) int {
 	return reported
 }
 
-// updFromEvent enriches cef with event attributes and details
-func (cmd *CmdRun) updFromEvent(cef *cefsyslog.CEF, er *api.EventRepresentation) {
+// send passes record to outputs routed by detection and returns true if none failed
+func (cmd *CmdRun) send(detection *config.Detection, rec *output.Record) bool {
+	ok := true
+	for _, o := range cmd.cfg.Outputs {
+		if !detection.Routes(o.Name) {
+			continue
+		}
+		err := cmd.sinks[o.Name].Send(rec)
+		if err != nil {
+			log.Printf("[%d] [%s] %s\n", rec.Time.UnixMilli(), o.Name, err.Error())
+			cmd.failed(o.Name, rec, err)
+			ok = false
+			continue
+		}
+		cmd.sent(o.Name, rec)
+	}
+	return ok
+}
+
+// sent counts record as delivered. Records queued by buffering outputs are counted once flushed
+func (cmd *CmdRun) sent(name string, rec *output.Record) {
+	if _, ok := cmd.sinks[name].(output.Flusher); !ok {
+		metrics.ObserveSend(name, nil)
+		return
+	}
+	if cmd.pending == nil {
+		cmd.pending = map[string]map[*output.Record]bool{}
+	}
+	if cmd.pending[name] == nil {
+		cmd.pending[name] = map[*output.Record]bool{}
+	}
+	cmd.pending[name][rec] = true
+}
+
+// failed counts and spools undelivered records. All records of a failed batch are undelivered, rec otherwise.
+// Events of records not spooled hold back the checkpoint of their source
+func (cmd *CmdRun) failed(name string, rec *output.Record, err error) {
+	recs := []*output.Record{rec}
+	var be *output.BatchError
+	if errors.As(err, &be) {
+		recs = be.Records
+	}
+	for _, r := range recs {
+		if r == nil {
+			continue
+		}
+		delete(cmd.pending[name], r)
+		metrics.ObserveSend(name, err)
+		if cmd.spoolRecord(name, r) || r.Event == nil || cmd.unsent == nil {
+			continue
+		}
+		if cmd.unsent[r.Source] == nil {
+			cmd.unsent[r.Source] = map[string]bool{}
+		}
+		cmd.unsent[r.Source][eventKey(r.Event)] = true
+	}
+}
+
+// flush waits for buffering outputs to send queued records and logs output counters
+func (cmd *CmdRun) flush() {
+	for _, o := range cmd.cfg.Outputs {
+		if f, ok := cmd.sinks[o.Name].(output.Flusher); ok {
+			if err := f.Flush(); err != nil {
+				log.Printf("[%s] %s\n", o.Name, err.Error())
+				cmd.failed(o.Name, nil, err)
+			}
+		}
+		for range cmd.pending[o.Name] {
+			metrics.ObserveSend(o.Name, nil)
+		}
+		delete(cmd.pending, o.Name)
+		if c, ok := cmd.sinks[o.Name].(output.Counter); ok {
+			for name, n := range c.Counters() {
+				if n > 0 {
+					log.Printf("[%s] %s: %d\n", o.Name, name, n)
+				}
+			}
+		}
+	}
+}
+
+// spoolRecord stores undelivered record in spool if configured and returns true if stored
+func (cmd *CmdRun) spoolRecord(name string, rec *output.Record) bool {
+	if cmd.spool == nil {
+		return false
+	}
+	if err := cmd.spool.Add(name, rec); err != nil {
+		log.Printf("[%d] [%s] spool: %s\n", rec.Time.UnixMilli(), name, err.Error())
+		return false
+	}
+	log.Printf("[%d] [%s] spooled\n", rec.Time.UnixMilli(), name)
+	return true
+}
+
+// replay resends spooled records
+func (cmd *CmdRun) replay() {
+	if cmd.spool == nil {
+		return
+	}
+	res, err := cmd.spool.Replay(func(e *spool.Entry) error {
+		sink, ok := cmd.sinks[e.Output]
+		if !ok {
+			return fmt.Errorf("unknown output: %s", e.Output)
+		}
+		return sink.Send(e.Record)
+	})
+	if err != nil {
+		log.Printf("[Spool] %s\n", err.Error())
+	}
+	if res.Sent+res.Failed+res.Expired > 0 {
+		log.Printf("[Spool] sent: %d; failed: %d; expired: %d\n", res.Sent, res.Failed, res.Expired)
+	}
+}
+
+// updFromEvent enriches cef with event attributes, details and name of source unless default
+func (cmd *CmdRun) updFromEvent(cef *cefsyslog.CEF, er *api.EventRepresentation, source string) {
+	if source != config.SourceDefault {
+		cef.Extension[cefsyslog.ExtDeviceExtID] = source
+	}
 	cef.Extension[cefsyslog.ExtSourceUserName] = er.GetDetail("username", "unknown")
 	cef.Extension[cefsyslog.ExtReceiptTime] = fmt.Sprintf("%d", er.Time)
 	if er.UserID != nil {
@@ -217,11 +612,26 @@ func (cmd *CmdRun) updFromEvent(cef *cefsyslog.CEF, er *api.EventRepresentation)
 	}
 }
 
-// values returns url.Values for api request
-func (cmd *CmdRun) values() url.Values {
+// window returns time range of events queried by sync
+func (cmd *CmdRun) window() (time.Time, time.Time) {
 	const timeDay = time.Hour * 24
 	dateTo := time.Now()
 	dateFrom := dateTo.Add(-(timeDay * time.Duration(cmd.cfg.Filter.Days)))
+	return dateFrom, dateTo
+}
+
+// slices returns slices of window if configured, nil otherwise
+func (cmd *CmdRun) slices() ([]api.Slice, error) {
+	if cmd.cfg.Filter.Slice == "" {
+		return nil, nil
+	}
+	from, to := cmd.window()
+	return api.Slices(from, to, cmd.cfg.Filter.Slice)
+}
+
+// values returns url.Values for api request
+func (cmd *CmdRun) values() url.Values {
+	dateFrom, dateTo := cmd.window()
 	values := url.Values{
 		api.QueryParamFrom: []string{dateFrom.Format(api.EventDateLayout)},
 		api.QueryParamTo:   []string{dateTo.Format(api.EventDateLayout)},
@@ -238,75 +648,96 @@ func (cmd *CmdRun) values() url.Values {
 
 // setConfig loads configuration
 func (cmd *CmdRun) setConfig(c *cli.Context) error {
-
-	var app string
-	var cwd string
 	var err error
-
-	if cwd, err = os.Getwd(); err != nil {
-		return err
-	}
-
-	if app, err = filepath.Abs(os.Args[0]); err != nil {
-		return err
-	}
-
-	cmd.cfg, err = config.NewFromFiles(
-		c.String(flagCfg),
-		cwd+"/logsync.json",
-		app+"/logsync.json",
-	)
-
+	cmd.cfg, err = loadConfig(c)
 	return err
 }
 
-// setLogging initializes logging
+// setLogging initializes logging. Logs are written to StdErr if events are written to StdOut
 func (cmd *CmdRun) setLogging() error {
 	var err error
-	log.SetOutput(os.Stdout)
+	var stdout io.Writer = os.Stdout
+	for _, o := range cmd.cfg.Outputs {
+		if o.File != nil && o.File.Path == output.FileStdout {
+			stdout = os.Stderr
+		}
+	}
+	log.SetOutput(stdout)
 	const perm = 0600
 	if cmd.cfg.Logfile != "" {
 		if cmd.logfile, err = os.OpenFile(cmd.cfg.Logfile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, perm); err != nil {
 			return err
 		}
-		log.SetOutput(io.MultiWriter(os.Stdout, cmd.logfile))
+		log.SetOutput(io.MultiWriter(stdout, cmd.logfile))
 	}
 	return nil
 }
 
-// setAPI initializes api
-func (cmd *CmdRun) setAPI() error {
-	var err error
-	cmd.api, err = api.NewAPI(
-		cmd.cfg.OAuth2.ClientID,
-		cmd.cfg.OAuth2.Secret,
-		cmd.cfg.OAuth2.TokenURL,
-		cmd.cfg.OAuth2.ContextURL,
-	)
-	return err
+// setAPIs initializes api per source
+func (cmd *CmdRun) setAPIs() error {
+	cmd.apis = map[string]*api.HubAPI{}
+	for _, src := range cmd.cfg.Sources {
+		a, err := api.NewAPI(
+			src.OAuth2.ClientID,
+			src.OAuth2.Secret,
+			src.OAuth2.TokenURL,
+			src.OAuth2.ContextURL,
+		)
+		if err != nil {
+			return fmt.Errorf("source %s: %w", src.Name, err)
+		}
+		a.SetContext(cmd.ctx)
+		cmd.apis[src.Name] = a
+	}
+	return nil
 }
 
-// setSyslog initializes syslog client
-func (cmd *CmdRun) setSyslog() error {
+// setCheckpoint loads checkpoint from file if configured
+func (cmd *CmdRun) setCheckpoint() error {
+	cmd.checkpoint = new(checkpoint)
+	if cmd.cfg.Checkpoint == "" {
+		return nil
+	}
 	var err error
-	cmd.ceflog, err = cefsyslog.SyslogWriterDial(
-		cmd.cfg.Syslog.Proto,
-		cmd.cfg.Syslog.Address,
-		cmd.cfg.Syslog.Facility,
-		cmd.cfg.Syslog.Tag,
-	)
-	return err
+	if cmd.checkpoint, err = loadCheckpoint(cmd.cfg.Checkpoint); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	return nil
+}
+
+// setOutputs initializes configured outputs
+func (cmd *CmdRun) setOutputs() error {
+	cmd.sinks = map[string]output.Sink{}
+	for _, o := range cmd.cfg.Outputs {
+		sink, err := newSink(cmd.ctx, o)
+		if err != nil {
+			return fmt.Errorf("output %s: %w", o.Name, err)
+		}
+		cmd.sinks[o.Name] = sink
+	}
+	return nil
 }
 
 // close takes care about open resources
 func (cmd *CmdRun) close() {
-	cmd.api = nil
-	if cmd.ceflog != nil {
-		_ = cmd.ceflog.Close()
-		cmd.ceflog = nil
+	cmd.shutdown()
+	cmd.apis = nil
+	for name, sink := range cmd.sinks {
+		if err := sink.Close(); err != nil {
+			log.Printf("[%s] %s\n", name, err.Error())
+			cmd.failed(name, nil, err)
+		}
+	}
+	cmd.sinks = nil
+	if cmd.spool != nil {
+		_ = cmd.spool.Close()
+		cmd.spool = nil
 	}
 	if cmd.logfile != nil {
 		_ = cmd.logfile.Close()
 		cmd.logfile = nil
 	}
+	if cmd.cancel != nil {
+		cmd.cancel()
+	}
 }
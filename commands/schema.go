@@ -0,0 +1,67 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/swisslearninghub/logsync/config"
+	"github.com/urfave/cli/v2"
+)
+
+const flagDetections = "detections"
+
+// CmdSchema ...
+type CmdSchema struct {
+	command
+}
+
+// newCmdSchema returns command printing JSON Schema of configuration
+func newCmdSchema() *cli.Command {
+
+	cmd := &CmdSchema{
+		command: command{
+			args: []cliArg{},
+		},
+	}
+
+	return &cli.Command{
+		Name:        "schema",
+		Usage:       "print JSON Schema of configuration",
+		Description: "Print JSON Schema of configuration to validate config files in editors or CI",
+		Before:      cmd.bootstrap(nil),
+		Action:      cmd.action,
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  flagDetections,
+				Usage: "print schema of detection files (detections_dir, include) instead",
+			},
+		},
+	}
+}
+
+// action prints schema
+func (cmd *CmdSchema) action(c *cli.Context) error {
+	s := config.Schema()
+	if c.Bool(flagDetections) {
+		s = config.DetectionsSchema()
+	}
+	bs, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	fmt.Println(string(bs))
+	return nil
+}
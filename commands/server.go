@@ -0,0 +1,65 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"context"
+	"errors"
+	"github.com/swisslearninghub/logsync/metrics"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	serverReadTimeout     = 10 * time.Second
+	serverShutdownTimeout = 5 * time.Second
+)
+
+// serve starts HTTP server exposing metrics and health endpoints if configured
+func (cmd *CmdRun) serve() error {
+	if cmd.cfg.HTTP == nil {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.HandleFunc("/healthz", cmd.healthz)
+	mux.HandleFunc("/readyz", cmd.readyz)
+
+	ln, err := net.Listen("tcp", cmd.cfg.HTTP.Listen)
+	if err != nil {
+		return err
+	}
+	cmd.server = &http.Server{Handler: mux, ReadHeaderTimeout: serverReadTimeout}
+	go func(srv *http.Server) {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[HTTP] %s\n", err.Error())
+		}
+	}(cmd.server)
+	log.Printf("[HTTP] listening on %s\n", ln.Addr().String())
+	return nil
+}
+
+// shutdown stops HTTP server
+func (cmd *CmdRun) shutdown() {
+	if cmd.server == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	_ = cmd.server.Shutdown(ctx)
+	cmd.server = nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"github.com/swisslearninghub/logsync/config"
+	"github.com/swisslearninghub/logsync/spool"
+	"github.com/urfave/cli/v2"
+	"sort"
+	"time"
+)
+
+const spoolSizeUnit = 1 << 20
+
+var errNoSpool = errors.New("spool not configured")
+
+// CmdSpool ...
+type CmdSpool struct {
+	command
+	spool *spool.Spool
+}
+
+// newCmdSpool returns command to inspect or purge spool
+func newCmdSpool() *cli.Command {
+
+	cmd := &CmdSpool{
+		command: command{
+			args: []cliArg{},
+		},
+	}
+
+	return &cli.Command{
+		Name:        "spool",
+		Description: "Inspect or purge undelivered events",
+		Before:      cmd.bootstrap(cmd.before),
+		After:       cmd.after,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:      flagCfg,
+				Usage:     "use `FILE` as config",
+				Aliases:   []string{flagCfgAlias},
+				TakesFile: true,
+				Value:     "logsync.json",
+			},
+			&cli.StringFlag{
+				Name:  flagCfgFormat,
+				Usage: "read config as `FORMAT` (json, yaml or toml) instead of detecting it by file extension",
+			},
+		},
+		Subcommands: []*cli.Command{
+			{
+				Name:        "info",
+				Usage:       "show spooled events per output",
+				Description: "Show spooled events per output",
+				Action:      cmd.info,
+			},
+			{
+				Name:        "purge",
+				Usage:       "remove all spooled events",
+				Description: "Remove all spooled events",
+				Action:      cmd.purge,
+			},
+		},
+	}
+}
+
+// before opens spool
+func (cmd *CmdSpool) before(c *cli.Context) error {
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	if cmd.spool, err = openSpool(cfg); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	if cmd.spool == nil {
+		return cli.Exit(errNoSpool.Error(), 1)
+	}
+	return nil
+}
+
+// after closes spool
+func (cmd *CmdSpool) after(_ *cli.Context) error {
+	if cmd.spool != nil {
+		_ = cmd.spool.Close()
+		cmd.spool = nil
+	}
+	return nil
+}
+
+// info prints spool statistics
+func (cmd *CmdSpool) info(_ *cli.Context) error {
+	st, err := cmd.spool.Stats()
+	if err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	fmt.Printf("Segments: %d\n", st.Segments)
+	fmt.Printf("Size:     %d bytes\n", st.Bytes)
+	fmt.Printf("Events:   %d\n", st.Entries)
+	if st.Entries == 0 {
+		return nil
+	}
+	fmt.Printf("Oldest:   %s\n", st.Oldest.Format(time.RFC3339))
+	fmt.Printf("Newest:   %s\n", st.Newest.Format(time.RFC3339))
+	var names []string
+	for name := range st.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("[%s] %d event(s)\n", name, st.Outputs[name])
+	}
+	return nil
+}
+
+// purge removes all spooled events. Refused while spool is used by a running logsync
+func (cmd *CmdSpool) purge(_ *cli.Context) error {
+	if err := cmd.spool.Lock(); err != nil {
+		if errors.Is(err, spool.ErrLocked) {
+			return cli.Exit(err.Error()+", stop it before purging", 1)
+		}
+		return cli.Exit(err.Error(), 1)
+	}
+	if err := cmd.spool.Purge(); err != nil {
+		return cli.Exit(err.Error(), 1)
+	}
+	fmt.Println("Spool purged")
+	return nil
+}
+
+// openSpool returns spool if configured, nil otherwise
+func openSpool(cfg *config.Config) (*spool.Spool, error) {
+	if cfg.Spool == nil {
+		return nil, nil
+	}
+	return spool.Open(
+		cfg.Spool.Dir,
+		int64(cfg.Spool.MaxSize)*spoolSizeUnit,
+		time.Duration(cfg.Spool.MaxAge)*time.Hour,
+	)
+}
@@ -15,46 +15,64 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/go-playground/validator/v10"
-	"github.com/swisslearninghub/logsync/cefsyslog"
 	"os"
 	"path/filepath"
+	"reflect"
 )
 
 // Config wraps up configured detections
 type Config struct {
-	Syslog struct {
-		Address  string             `json:"address"    validate:"required,hostname_port"`
-		Proto    string             `json:"proto"      validate:"required,oneof=tcp udp"`
-		Tag      string             `json:"tag"        validate:"required,gt=0,lte=32"`
-		Facility cefsyslog.Priority `json:"facility"   validate:"required,oneof=0 8 16 24 32 40 48 56 64 72 80 88"`
-	} `json:"syslog"`
-	OAuth2 struct {
-		ClientID   string `json:"client_id"   validate:"required,gt=0"`
-		Secret     string `json:"secret"      validate:"required,gt=0"`
-		TokenURL   string `json:"token_url"   validate:"required,url"`
-		ContextURL string `json:"context_url" validate:"required,url"`
-	} `json:"oauth2"`
-	Filter struct {
-		Type []string `json:"type"`
-		Days int      `json:"days" validate:"required,gt=0,lte=7"`
-		Max  int      `json:"max"  validate:"required,gt=0,lte=999999"`
+	Syslog  *Syslog  `json:"syslog"  validate:"omitempty"`
+	File    *File    `json:"file"    validate:"omitempty"`
+	GELF    *GELF    `json:"gelf"    validate:"omitempty"`
+	Outputs []Output `json:"outputs" validate:"omitempty,dive"`
+	OAuth2  *OAuth2  `json:"oauth2"  validate:"omitempty"`
+	Sources []Source `json:"sources" validate:"omitempty,dive"`
+	Filter  struct {
+		Type    []string `json:"type"`
+		Days    int      `json:"days"    validate:"required,gt=0,lte=7"`
+		Max     int      `json:"max"     validate:"required,gt=0,lte=999999"`
+		Slice   string   `json:"slice"   validate:"omitempty,oneof=day"`
+		Workers int      `json:"workers" validate:"omitempty,gt=0,lte=32"`
 	} `json:"filter"`
-	Detections []Detection `json:"detections" validate:"required,gt=0"`
-	Logfile    string      `json:"logfile"    validate:"omitempty,gt=0"`
+	Spool *struct {
+		Dir     string `json:"dir"      validate:"required"`
+		MaxSize int    `json:"max_size" validate:"omitempty,gt=0"`
+		MaxAge  int    `json:"max_age"  validate:"omitempty,gt=0"`
+	} `json:"spool" validate:"omitempty"`
+	HTTP *struct {
+		Listen     string `json:"listen"       validate:"required,hostname_port"`
+		MaxSyncAge int    `json:"max_sync_age" validate:"omitempty,gt=0"`
+	} `json:"http" validate:"omitempty"`
+	Checkpoint    string      `json:"checkpoint" validate:"omitempty,gt=0"`
+	Device        Device      `json:"device"`
+	Detections    []Detection `json:"detections"`
+	DetectionsDir string      `json:"detections_dir" validate:"omitempty,gt=0"`
+	Include       []string    `json:"include"        validate:"omitempty,dive,gt=0"`
+	Logfile       string      `json:"logfile"        validate:"omitempty,gt=0"`
+	path          string      // file configuration was read from, empty if read from bytes
+	dir           string      // directory relative include paths are resolved against
 }
 
 var ErrConfigNotFound = errors.New("config not found")
 
-// NewFromFiles returns *Config
+// NewFromFiles returns *Config. Format is detected by file extension
 func NewFromFiles(paths ...string) (*Config, error) {
+	return NewFromFilesFormat("", paths...)
+}
+
+// NewFromFilesFormat returns *Config from first existing file. Empty format is detected by file extension
+func NewFromFilesFormat(format string, paths ...string) (*Config, error) {
 	for _, path := range paths {
 		if path == "" {
 			continue
 		}
-		cfg, err := NewFromFile(path)
+		cfg, err := NewFromFileFormat(path, format)
 		if err != nil {
 			if errors.Is(err, ErrConfigNotFound) {
 				continue
@@ -66,8 +84,14 @@ func NewFromFiles(paths ...string) (*Config, error) {
 	return nil, ErrConfigNotFound
 }
 
-// NewFromFile returns config
+// NewFromFile returns config. Format is detected by file extension
 func NewFromFile(file string) (*Config, error) {
+	return NewFromFileFormat(file, "")
+}
+
+// NewFromFileFormat returns config from file in given format (json, yaml or toml). Empty format is detected by file
+// extension
+func NewFromFileFormat(file, format string) (*Config, error) {
 
 	var p string
 	var err error
@@ -86,14 +110,51 @@ func NewFromFile(file string) (*Config, error) {
 		return nil, err
 	}
 
-	return NewFromBytes(bs)
+	if format == "" {
+		format = FileFormatFromPath(p)
+	}
+
+	if bs, err = toJSON(bs, format); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	var c *Config
+
+	if c, err = newFromBytes(bs, filepath.Dir(p)); err != nil {
+		return nil, err
+	}
+
+	c.path = p
+
+	return c, nil
 }
 
-// NewFromBytes returns Config
+// NewFromBytes returns Config. Values are overridden from secret files and environment variables (see applyOverrides).
+// Relative detections_dir, include and <key>_file paths are resolved against the working directory
 func NewFromBytes(bs []byte) (*Config, error) {
+	return newFromBytes(bs, "")
+}
+
+// newFromBytes returns Config resolving relative detections_dir, include and <key>_file paths against dir
+func newFromBytes(bs []byte, dir string) (*Config, error) {
 
 	var err error
 
+	raw := map[string]interface{}{}
+	d := json.NewDecoder(bytes.NewReader(bs))
+	d.UseNumber()
+	if err = d.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	if err = applyOverrides(raw, reflect.TypeOf(Config{}), dir); err != nil {
+		return nil, err
+	}
+
+	if bs, err = json.Marshal(raw); err != nil {
+		return nil, err
+	}
+
 	c := new(Config)
 
 	if err = json.Unmarshal(bs, c); err != nil {
@@ -105,5 +166,32 @@ func NewFromBytes(bs []byte) (*Config, error) {
 		return nil, err
 	}
 
+	c.dir = dir
+
+	if err = c.includeDetections(dir); err != nil {
+		return nil, err
+	}
+
+	if err = c.checkDetections(); err != nil {
+		return nil, err
+	}
+
+	if err = c.PrepareDetections(c.Device); err != nil {
+		return nil, err
+	}
+
+	if err = c.setSources(); err != nil {
+		return nil, err
+	}
+
+	if err = c.setOutputs(); err != nil {
+		return nil, err
+	}
+
 	return c, nil
 }
+
+// Path returns file configuration was read from, empty if read from bytes
+func (c *Config) Path() string {
+	return c.path
+}
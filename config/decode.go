@@ -0,0 +1,73 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// Decoding of YAML and TOML configuration. Keys are the same as in JSON
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"strings"
+)
+
+// Configuration file formats
+const (
+	FileFormatJSON = "json"
+	FileFormatYAML = "yaml"
+	FileFormatTOML = "toml"
+)
+
+// FileExtensions are the extensions of supported configuration files
+var FileExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// FileFormatFromPath returns configuration format by file extension. JSON is used for unknown extensions
+func FileFormatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FileFormatYAML
+	case ".toml":
+		return FileFormatTOML
+	default:
+		return FileFormatJSON
+	}
+}
+
+// toJSON returns configuration in given format as JSON. YAML documents may be lists (detection files)
+func toJSON(bs []byte, format string) ([]byte, error) {
+	var v interface{}
+	switch format {
+	case "", FileFormatJSON:
+		return bs, nil
+	case FileFormatYAML:
+		if err := yaml.Unmarshal(bs, &v); err != nil {
+			return nil, err
+		}
+	case FileFormatTOML:
+		var m map[string]interface{}
+		if err := toml.Unmarshal(bs, &m); err != nil {
+			return nil, err
+		}
+		v = m
+	default:
+		return nil, fmt.Errorf("unknown config format: %s", format)
+	}
+	if v == nil {
+		v = map[string]interface{}{}
+	}
+	return json.Marshal(v)
+}
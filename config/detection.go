@@ -15,24 +15,27 @@
 package config
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/swisslearninghub/logsync/api"
 	"github.com/swisslearninghub/logsync/cefsyslog"
 )
 
-// Reporter identifiers
-const (
-	typeType            = "type"
-	typeDetailExists    = "detail_exists"
-	typeDetailNotExists = "detail_not_exists"
-)
-
 // Detection ...
+// Validate tags are not evaluated when loading, detections are validated by check(). The tags mirror check() for the
+// generated schema (see DetectionsSchema)
 type Detection struct {
 	ClassID   string             `json:"class_id"  validate:"required,gt=0"`
 	Name      string             `json:"name"      validate:"required,gt=0"`
-	Severity  cefsyslog.Priority `json:"severity"  validate:"required,gte=0,lte=10"`
-	LogLevel  cefsyslog.Priority `json:"loglevel"  validate:"required,gte=0,lte=7"`
+	Severity  cefsyslog.Priority `json:"severity"  validate:"gte=0,lte=10"`
+	LogLevel  cefsyslog.Priority `json:"loglevel"  validate:"oneof=0 1 2 3 4 5 6 7"`
 	Reporters []Reporter         `json:"reporters" validate:"required,gt=0"`
+	Device    Device             `json:"device"`
+	Outputs   []string           `json:"outputs"`
+	device    *deviceTemplates
+	source    string // file detection was included from, empty if main configuration
 }
 
 // Report returns true if all reporters do (operator: and)
@@ -42,22 +45,14 @@ func (d *Detection) Report(er *api.EventRepresentation) bool {
 		return false
 	}
 
-	var rep Report
-
 	reported := 0
 
 	for _, reporter := range d.Reporters {
-		switch reporter.Type {
-		case typeDetailExists:
-			rep = NewDetailExistsReporter(reporter)
-		case typeDetailNotExists:
-			rep = NewDetailNotExistsReporter(reporter)
-		case typeType:
-			rep = NewTypeReporter(reporter)
-		default:
+		rt, ok := reporterTypes[reporter.Type]
+		if !ok {
 			continue
 		}
-		if rep.Do(er) {
+		if rt.new(reporter).Do(er) {
 			reported++
 		}
 	}
@@ -65,7 +60,102 @@ func (d *Detection) Report(er *api.EventRepresentation) bool {
 	return reported == len(d.Reporters)
 }
 
-// CEF returns basic *cefsyslog.CEF
-func (d *Detection) CEF() *cefsyslog.CEF {
-	return cefsyslog.NewCEF(d.ClassID, d.Name, d.Severity)
+// Routes returns true if events are reported to given output. Events are reported to all outputs if none are set
+func (d *Detection) Routes(output string) bool {
+	if len(d.Outputs) == 0 {
+		return true
+	}
+	for _, o := range d.Outputs {
+		if o == output {
+			return true
+		}
+	}
+	return false
+}
+
+// CEF returns basic *cefsyslog.CEF with device fields rendered from given event
+func (d *Detection) CEF(er *api.EventRepresentation) (*cefsyslog.CEF, error) {
+	cef := cefsyslog.NewCEF(d.ClassID, d.Name, d.Severity)
+	if err := d.device.apply(cef, er); err != nil {
+		return nil, fmt.Errorf("detection %s: device: %w", d.ClassID, err)
+	}
+	return cef, nil
+}
+
+// Source returns file detection was included from, empty if main configuration
+func (d *Detection) Source() string {
+	return d.source
+}
+
+// prepare parses device fields of detection, falling back to given global device fields
+func (d *Detection) prepare(global Device) error {
+	var err error
+	if d.device, err = d.Device.merge(global).parse(); err != nil {
+		return d.errorf("device: %w", err)
+	}
+	return nil
+}
+
+// check validates fields, zero severity and loglevel are valid
+func (d *Detection) check() error {
+	switch {
+	case d.ClassID == "":
+		return errors.New("class_id required")
+	case d.Name == "":
+		return errors.New("name required")
+	case d.Severity < 0 || d.Severity > 10:
+		return fmt.Errorf("severity out of range: %d", d.Severity)
+	case d.LogLevel < 0 || d.LogLevel > 7:
+		return fmt.Errorf("loglevel out of range: %d", d.LogLevel)
+	case len(d.Reporters) == 0:
+		return errors.New("reporters required")
+	}
+	for i, r := range d.Reporters {
+		if _, ok := reporterTypes[r.Type]; !ok {
+			return fmt.Errorf("reporter %d: unknown type: %s", i, r.Type)
+		}
+	}
+	return nil
+}
+
+// errorf returns error prefixed with source and class ID of detection
+func (d *Detection) errorf(format string, a ...interface{}) error {
+	err := fmt.Errorf("detection %s: "+format, append([]interface{}{d.ClassID}, a...)...)
+	if d.source != "" {
+		return fmt.Errorf("%s: %w", d.source, err)
+	}
+	return err
+}
+
+// sourceName returns source for messages
+func (d *Detection) sourceName() string {
+	if d.source == "" {
+		return "main configuration"
+	}
+	return d.source
+}
+
+// DiffDetections returns class IDs of detections added, removed and changed in next compared to prev
+func DiffDetections(prev, next []Detection) (added, removed, changed []string) {
+	old := map[string][]byte{}
+	for i := range prev {
+		old[prev[i].ClassID], _ = json.Marshal(&prev[i])
+	}
+	for i := range next {
+		bs, _ := json.Marshal(&next[i])
+		p, ok := old[next[i].ClassID]
+		switch {
+		case !ok:
+			added = append(added, next[i].ClassID)
+		case !bytes.Equal(p, bs):
+			changed = append(changed, next[i].ClassID)
+		}
+		delete(old, next[i].ClassID)
+	}
+	for i := range prev {
+		if _, ok := old[prev[i].ClassID]; ok {
+			removed = append(removed, prev[i].ClassID)
+		}
+	}
+	return
 }
@@ -0,0 +1,113 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/swisslearninghub/logsync/api"
+	"reflect"
+	"testing"
+)
+
+func TestDiffDetections(t *testing.T) {
+	prev := []Detection{
+		{ClassID: "1", Name: "kept"},
+		{ClassID: "2", Name: "changed"},
+		{ClassID: "3", Name: "removed"},
+		{ClassID: "4", Name: "rerouted", Outputs: []string{"a"}},
+	}
+	next := []Detection{
+		{ClassID: "4", Name: "rerouted", Outputs: []string{"a", "b"}},
+		{ClassID: "5", Name: "added"},
+		{ClassID: "2", Name: "changed", Severity: 7},
+		{ClassID: "1", Name: "kept", source: "other.json"},
+	}
+	added, removed, changed := DiffDetections(prev, next)
+	if !reflect.DeepEqual(added, []string{"5"}) {
+		t.Errorf("added: got %v, want [5]", added)
+	}
+	if !reflect.DeepEqual(removed, []string{"3"}) {
+		t.Errorf("removed: got %v, want [3]", removed)
+	}
+	if !reflect.DeepEqual(changed, []string{"4", "2"}) {
+		t.Errorf("changed: got %v, want [4 2]", changed)
+	}
+
+	added, removed, changed = DiffDetections(prev, prev)
+	if len(added)+len(removed)+len(changed) != 0 {
+		t.Errorf("same detections: got added %v, removed %v, changed %v", added, removed, changed)
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	prev := &Config{Checkpoint: "a.json", Detections: []Detection{{ClassID: "1"}}}
+	next := &Config{Checkpoint: "a.json", DetectionsDir: "detections", Include: []string{"*.json"}}
+	if keys := prev.ChangedSettings(next); len(keys) != 0 {
+		t.Errorf("detection settings: got %v, want none", keys)
+	}
+
+	next.Checkpoint = "b.json"
+	next.Device.Vendor = "other"
+	if keys := prev.ChangedSettings(next); !reflect.DeepEqual(keys, []string{"checkpoint", "device"}) {
+		t.Errorf("got %v, want [checkpoint device]", keys)
+	}
+}
+
+func TestPrepareDetections(t *testing.T) {
+	next := &Config{Device: Device{Vendor: "next"}, Detections: []Detection{{ClassID: "1"}, {ClassID: "2", Device: Device{Vendor: "own"}}}}
+	if err := next.PrepareDetections(Device{Vendor: "running"}); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"running", "own"} {
+		cef, err := next.Detections[i].CEF(&api.EventRepresentation{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cef.DeviceVendor != want {
+			t.Errorf("detection %s: got vendor %s, want %s", next.Detections[i].ClassID, cef.DeviceVendor, want)
+		}
+	}
+}
+
+// TestDetectionTags asserts validate tags, which only feed the schema, agree with check()
+func TestDetectionTags(t *testing.T) {
+	valid := func() Detection {
+		return Detection{ClassID: "1", Name: "n", Reporters: []Reporter{{Type: "type", Config: map[string]string{"type": "LOGIN"}}}}
+	}
+	tests := []struct {
+		name string
+		edit func(d *Detection)
+	}{
+		{"valid", func(d *Detection) {}},
+		{"zero severity and loglevel", func(d *Detection) { d.Severity, d.LogLevel = 0, 0 }},
+		{"max severity and loglevel", func(d *Detection) { d.Severity, d.LogLevel = 10, 7 }},
+		{"no class_id", func(d *Detection) { d.ClassID = "" }},
+		{"no name", func(d *Detection) { d.Name = "" }},
+		{"negative severity", func(d *Detection) { d.Severity = -1 }},
+		{"severity too high", func(d *Detection) { d.Severity = 11 }},
+		{"negative loglevel", func(d *Detection) { d.LogLevel = -1 }},
+		{"loglevel too high", func(d *Detection) { d.LogLevel = 8 }},
+		{"no reporters", func(d *Detection) { d.Reporters = nil }},
+	}
+	v := validator.New()
+	for _, tt := range tests {
+		d := valid()
+		tt.edit(&d)
+		errTags, errCheck := v.Struct(&d), d.check()
+		if (errTags == nil) != (errCheck == nil) {
+			t.Errorf("%s: tags: %v; check: %v", tt.name, errTags, errCheck)
+		}
+	}
+}
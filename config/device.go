@@ -0,0 +1,111 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"strings"
+	"text/template"
+)
+
+// Device holds CEF header device fields. Values may use text/template syntax with the event as data
+type Device struct {
+	Vendor  string `json:"vendor"  validate:"omitempty,gt=0"`
+	Product string `json:"product" validate:"omitempty,gt=0"`
+	Version string `json:"version" validate:"omitempty,gt=0"`
+}
+
+// deviceTemplates holds parsed device fields. A nil template keeps the CEF default
+type deviceTemplates struct {
+	vendor  *template.Template
+	product *template.Template
+	version *template.Template
+}
+
+var deviceFuncs = template.FuncMap{
+	"default": func(def string, v *string) string {
+		if v == nil || *v == "" {
+			return def
+		}
+		return *v
+	},
+}
+
+// merge returns device with empty fields taken from fallback
+func (d Device) merge(fallback Device) Device {
+	if d.Vendor == "" {
+		d.Vendor = fallback.Vendor
+	}
+	if d.Product == "" {
+		d.Product = fallback.Product
+	}
+	if d.Version == "" {
+		d.Version = fallback.Version
+	}
+	return d
+}
+
+// parse returns parsed templates of device fields
+func (d Device) parse() (*deviceTemplates, error) {
+	var err error
+	t := new(deviceTemplates)
+	if t.vendor, err = parseDeviceField("vendor", d.Vendor); err != nil {
+		return nil, err
+	}
+	if t.product, err = parseDeviceField("product", d.Product); err != nil {
+		return nil, err
+	}
+	if t.version, err = parseDeviceField("version", d.Version); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func parseDeviceField(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New(name).Funcs(deviceFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// apply sets device fields of cef rendered from given event
+func (t *deviceTemplates) apply(cef *cefsyslog.CEF, er *api.EventRepresentation) error {
+	var err error
+	if t == nil {
+		return nil
+	}
+	if err = executeDeviceField(t.vendor, er, &cef.DeviceVendor); err != nil {
+		return err
+	}
+	if err = executeDeviceField(t.product, er, &cef.DeviceProduct); err != nil {
+		return err
+	}
+	return executeDeviceField(t.version, er, &cef.DeviceVersion)
+}
+
+func executeDeviceField(t *template.Template, er *api.EventRepresentation, field *string) error {
+	if t == nil {
+		return nil
+	}
+	var sb strings.Builder
+	if err := t.Execute(&sb, er); err != nil {
+		return err
+	}
+	if sb.Len() > 0 {
+		*field = sb.String()
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// Overrides of configuration values from secret files and environment variables. Precedence (highest first):
+//
+//  1. LOGSYNC_<KEY>        environment variable holding the value
+//  2. LOGSYNC_<KEY>_FILE   environment variable holding path of a file containing the value (Docker/Kubernetes secrets)
+//  3. <key>_file           configuration key holding path of a file containing the value, relative to the
+//                          configuration file
+//  4. <key>                configuration value
+//
+// <KEY> is the upper case path of the key joined by underscore, slice elements by index,
+// i.e. LOGSYNC_OAUTH2_SECRET or LOGSYNC_OUTPUTS_0_SYSLOG_ADDRESS.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	envPrefix     = "LOGSYNC"
+	envFileSuffix = "_FILE"
+	keyFileSuffix = "_file"
+)
+
+// applyOverrides sets values of all keys of t in raw configuration from secret files and environment variables.
+// Relative paths of <key>_file keys are resolved against dir
+func applyOverrides(raw map[string]interface{}, t reflect.Type, dir string) error {
+	return overrideStruct(raw, t, envPrefix, dir)
+}
+
+// overrideStruct applies overrides to fields of struct type t in m
+func overrideStruct(m map[string]interface{}, t reflect.Type, env, dir string) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := jsonKey(f)
+		if key == "" {
+			continue
+		}
+		fenv := env + "_" + strings.ToUpper(key)
+		ft := indirect(f.Type)
+
+		var err error
+		switch {
+		case ft.Kind() == reflect.Struct:
+			err = overrideNested(m, key, ft, fenv, dir)
+		case ft.Kind() == reflect.Slice && indirect(ft.Elem()).Kind() == reflect.Struct:
+			err = overrideSlice(m, key, indirect(ft.Elem()), fenv, dir)
+		default:
+			err = overrideLeaf(m, key, ft, fenv, dir)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overrideNested applies overrides to nested struct at key, which is added if any override is set
+func overrideNested(m map[string]interface{}, key string, t reflect.Type, env, dir string) error {
+	sub, ok := m[key].(map[string]interface{})
+	if !ok {
+		sub = map[string]interface{}{}
+	}
+	if err := overrideStruct(sub, t, env, dir); err != nil {
+		return err
+	}
+	if ok || len(sub) > 0 {
+		m[key] = sub
+	}
+	return nil
+}
+
+// overrideSlice replaces slice at key by JSON from environment and applies overrides to its elements
+func overrideSlice(m map[string]interface{}, key string, t reflect.Type, env, dir string) error {
+	if err := overrideLeaf(m, key, reflect.TypeOf([]interface{}{}), env, dir); err != nil {
+		return err
+	}
+	items, _ := m[key].([]interface{})
+	for i, item := range items {
+		sub, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := overrideStruct(sub, t, env+"_"+strconv.Itoa(i), dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overrideLeaf sets value at key in order of precedence
+func overrideLeaf(m map[string]interface{}, key string, t reflect.Type, env, dir string) error {
+	if path, ok := m[key+keyFileSuffix].(string); ok {
+		delete(m, key+keyFileSuffix)
+		if err := setFromFile(m, key, t, resolve(dir, path)); err != nil {
+			return err
+		}
+	}
+	if path, ok := os.LookupEnv(env + envFileSuffix); ok {
+		if err := setFromFile(m, key, t, path); err != nil {
+			return fmt.Errorf("%s%s: %w", env, envFileSuffix, err)
+		}
+	}
+	if s, ok := os.LookupEnv(env); ok {
+		v, err := parseValue(s, t)
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		m[key] = v
+	}
+	return nil
+}
+
+// setFromFile sets value at key to content of file. A trailing line break is removed
+func setFromFile(m map[string]interface{}, key string, t reflect.Type, path string) error {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	v, err := parseValue(strings.TrimRight(string(bs), "\r\n"), t)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	m[key] = v
+	return nil
+}
+
+// parseValue returns s as value of kind t. Strings are taken as they are, string slices may be comma separated,
+// all other kinds are decoded as JSON
+func parseValue(s string, t reflect.Type) (interface{}, error) {
+	switch {
+	case t.Kind() == reflect.String:
+		return s, nil
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String && !strings.HasPrefix(s, "["):
+		var items []interface{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	var v interface{}
+	d := json.NewDecoder(strings.NewReader(s))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// jsonKey returns JSON key of exported field, empty if not encoded
+func jsonKey(f reflect.StructField) string {
+	if f.PkgPath != "" {
+		return ""
+	}
+	tag := strings.Split(f.Tag.Get("json"), ",")[0]
+	if tag == "-" {
+		return ""
+	}
+	if tag == "" {
+		return f.Name
+	}
+	return tag
+}
+
+// indirect returns element type of pointers
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testOverrideItem struct {
+	Address string `json:"address"`
+}
+
+type testOverrides struct {
+	Secret string   `json:"secret"`
+	Port   int      `json:"port"`
+	Types  []string `json:"types"`
+	Nested struct {
+		Key string `json:"key"`
+	} `json:"nested"`
+	Items []testOverrideItem `json:"items"`
+	Skip  string             `json:"-"`
+}
+
+// overridden returns raw configuration with overrides applied, relative files resolved against dir
+func overridden(t *testing.T, raw, dir string) map[string]interface{} {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyOverrides(m, reflect.TypeOf(testOverrides{}), dir); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// writeFile writes content to name in dir and returns its path
+func writeFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestOverrideKeys(t *testing.T) {
+	t.Setenv("LOGSYNC_PORT", "514")
+	t.Setenv("LOGSYNC_TYPES", "LOGIN, LOGOUT,")
+	t.Setenv("LOGSYNC_NESTED_KEY", "nested")
+	t.Setenv("LOGSYNC_ITEMS_1_ADDRESS", "b:514")
+	t.Setenv("LOGSYNC_SKIP", "skipped")
+
+	m := overridden(t, `{"items":[{"address":"a:514"},{"address":"x"}]}`, "")
+	want := map[string]interface{}{
+		"port":   json.Number("514"),
+		"types":  []interface{}{"LOGIN", "LOGOUT"},
+		"nested": map[string]interface{}{"key": "nested"},
+		"items":  []interface{}{map[string]interface{}{"address": "a:514"}, map[string]interface{}{"address": "b:514"}},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %v, want %v", m, want)
+	}
+
+	// slice replaced by JSON before its elements are overridden
+	t.Setenv("LOGSYNC_ITEMS", `[{"address":"c:514"},{"address":"d:514"}]`)
+	m = overridden(t, `{}`, "")
+	if items := m["items"].([]interface{}); items[0].(map[string]interface{})["address"] != "c:514" ||
+		items[1].(map[string]interface{})["address"] != "b:514" {
+		t.Errorf("got items %v, want c:514 and b:514", items)
+	}
+}
+
+func TestOverridePrecedence(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := writeFile(t, dir, "key", "from key file\n")
+	envFile := writeFile(t, dir, "env", "from env file\r\n")
+
+	raw := `{"secret":"from config","secret_file":"` + filepath.ToSlash(keyFile) + `"}`
+	steps := []struct {
+		env, value string
+		want       string
+	}{
+		{"", "", "from key file"},
+		{"LOGSYNC_SECRET_FILE", envFile, "from env file"},
+		{"LOGSYNC_SECRET", "from env", "from env"},
+	}
+	if m := overridden(t, `{"secret":"from config"}`, ""); m["secret"] != "from config" {
+		t.Errorf("got %v, want configuration value", m["secret"])
+	}
+	for _, s := range steps {
+		if s.env != "" {
+			t.Setenv(s.env, s.value)
+		}
+		m := overridden(t, raw, "")
+		if m["secret"] != s.want {
+			t.Errorf("got %q, want %q", m["secret"], s.want)
+		}
+		if _, ok := m["secret_file"]; ok {
+			t.Error("got secret_file key left in configuration")
+		}
+	}
+}
+
+func TestOverrideFileRelative(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "secret", "relative\n")
+
+	if m := overridden(t, `{"secret_file":"secret"}`, dir); m["secret"] != "relative" {
+		t.Errorf("got %q, want content of file in configuration directory", m["secret"])
+	}
+
+	// environment paths are taken as given
+	t.Setenv("LOGSYNC_SECRET_FILE", "secret")
+	m := map[string]interface{}{}
+	if err := applyOverrides(m, reflect.TypeOf(testOverrides{}), dir); err == nil {
+		t.Errorf("got %v, want relative env file not resolved against configuration directory", m["secret"])
+	}
+}
+
+func TestOverrideInvalid(t *testing.T) {
+	t.Setenv("LOGSYNC_PORT", "not a number")
+	m := map[string]interface{}{}
+	if err := applyOverrides(m, reflect.TypeOf(testOverrides{}), ""); err == nil {
+		t.Error("got no error for invalid value")
+	}
+}
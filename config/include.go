@@ -0,0 +1,207 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// Detections loaded from files of detections_dir and include globs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrNoDetections = errors.New("no detections configured")
+
+// detectionFile is the object form of a detection file, required for TOML
+type detectionFile struct {
+	Detections []Detection `json:"detections"`
+}
+
+// Files returns configuration file, detections dir and currently matching include files. Directories and files are
+// rescanned, so files added since loading are returned as well
+func (c *Config) Files() ([]string, error) {
+	var files []string
+	if c.path != "" {
+		files = append(files, c.path)
+	}
+	if c.DetectionsDir != "" {
+		files = append(files, resolve(c.dir, c.DetectionsDir))
+	}
+	included, err := c.includeFiles(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, included...), nil
+}
+
+// ReplaceDetections takes detections and include settings of next, other settings are kept
+func (c *Config) ReplaceDetections(next *Config) {
+	c.Detections = next.Detections
+	c.DetectionsDir = next.DetectionsDir
+	c.Include = next.Include
+}
+
+// PrepareDetections parses device fields of detections, falling back to given global device fields. Detections of a
+// reloaded configuration are prepared with the global device fields of the running one
+func (c *Config) PrepareDetections(global Device) error {
+	for i := range c.Detections {
+		if err := c.Detections[i].prepare(global); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChangedSettings returns keys of settings other than detections and include settings differing in next, sorted.
+// Those are not taken by ReplaceDetections
+func (c *Config) ChangedSettings(next *Config) []string {
+	settings := func(cfg *Config) map[string]json.RawMessage {
+		plain := *cfg
+		plain.ReplaceDetections(&Config{})
+		m := map[string]json.RawMessage{}
+		bs, _ := json.Marshal(&plain)
+		_ = json.Unmarshal(bs, &m)
+		return m
+	}
+	prev, cur := settings(c), settings(next)
+	var keys []string
+	for key, value := range cur {
+		if !bytes.Equal(prev[key], value) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// includeDetections appends detections of included files. Relative paths are resolved against dir
+func (c *Config) includeDetections(dir string) error {
+	files, err := c.includeFiles(dir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		ds, err := readDetections(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for i := range ds {
+			ds[i].source = file
+		}
+		c.Detections = append(c.Detections, ds...)
+	}
+	return nil
+}
+
+// includeFiles returns sorted configuration files of detections dir followed by files matching include globs
+func (c *Config) includeFiles(dir string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{}
+	add := func(matches []string) {
+		sort.Strings(matches)
+		for _, file := range matches {
+			if !seen[file] {
+				seen[file] = true
+				files = append(files, file)
+			}
+		}
+	}
+
+	if c.DetectionsDir != "" {
+		entries, err := os.ReadDir(resolve(dir, c.DetectionsDir))
+		if err != nil {
+			return nil, fmt.Errorf("detections_dir: %w", err)
+		}
+		var matches []string
+		for _, entry := range entries {
+			if !entry.IsDir() && isConfigFile(entry.Name()) {
+				matches = append(matches, filepath.Join(resolve(dir, c.DetectionsDir), entry.Name()))
+			}
+		}
+		add(matches)
+	}
+
+	for _, pattern := range c.Include {
+		matches, err := filepath.Glob(resolve(dir, pattern))
+		if err != nil {
+			return nil, fmt.Errorf("include %s: %w", pattern, err)
+		}
+		add(matches)
+	}
+
+	return files, nil
+}
+
+// readDetections returns detections of file given as list or as object with key detections
+func readDetections(file string) ([]Detection, error) {
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if bs, err = toJSON(bs, FileFormatFromPath(file)); err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(bs), []byte("[")) {
+		var ds []Detection
+		err = json.Unmarshal(bs, &ds)
+		return ds, err
+	}
+	var f detectionFile
+	err = json.Unmarshal(bs, &f)
+	return f.Detections, err
+}
+
+// checkDetections validates merged detections and rejects duplicate class IDs
+func (c *Config) checkDetections() error {
+	if len(c.Detections) == 0 {
+		return ErrNoDetections
+	}
+	first := map[string]*Detection{}
+	for i := range c.Detections {
+		d := &c.Detections[i]
+		if err := d.check(); err != nil {
+			return d.errorf("%w", err)
+		}
+		if prev, ok := first[d.ClassID]; ok {
+			return d.errorf("duplicate class id, first defined in %s", prev.sourceName())
+		}
+		first[d.ClassID] = d
+	}
+	return nil
+}
+
+// isConfigFile returns true for files with extension of a supported configuration format
+func isConfigFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range FileExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns path relative to dir unless absolute
+func resolve(dir, path string) string {
+	if filepath.IsAbs(path) || dir == "" {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
@@ -0,0 +1,293 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"net"
+	"strings"
+)
+
+// Output identifiers
+const (
+	OutputSyslog  = "syslog"
+	OutputFile    = "file"
+	OutputGELF    = "gelf"
+	OutputWebhook = "webhook"
+	OutputHEC     = "hec"
+	OutputKafka   = "kafka"
+)
+
+var ErrNoOutput = errors.New("no output configured")
+
+// Output is a named destination for reported events. Configuration is taken from the key matching type
+type Output struct {
+	Name    string   `json:"name"    validate:"required,gt=0"`
+	Type    string   `json:"type"    validate:"required,oneof=syslog file gelf webhook hec kafka"`
+	Syslog  *Syslog  `json:"syslog"  validate:"required_if=Type syslog,omitempty"`
+	File    *File    `json:"file"    validate:"required_if=Type file,omitempty"`
+	GELF    *GELF    `json:"gelf"    validate:"required_if=Type gelf,omitempty"`
+	Webhook *Webhook `json:"webhook" validate:"required_if=Type webhook,omitempty"`
+	HEC     *HEC     `json:"hec"     validate:"required_if=Type hec,omitempty"`
+	Kafka   *Kafka   `json:"kafka"   validate:"required_if=Type kafka,omitempty"`
+}
+
+// check validates output configuration beyond struct tags
+func (o *Output) check() error {
+	switch {
+	case o.Syslog != nil:
+		return o.Syslog.check()
+	case o.Webhook != nil:
+		return o.Webhook.check()
+	}
+	return nil
+}
+
+// Syslog protocols besides tcp and udp
+const (
+	SyslogLocal    = "local"
+	SyslogUnix     = "unix"
+	SyslogUnixgram = "unixgram"
+	SyslogJournald = "journald"
+)
+
+// Syslog configures a remote syslog server. Further servers in addresses are used for failover or round-robin.
+// For local protocols addresses are socket paths and may be omitted.
+type Syslog struct {
+	Address   string             `json:"address"`
+	Addresses []string           `json:"addresses"`
+	Mode      string             `json:"mode"       validate:"omitempty,oneof=failover roundrobin"`
+	Recheck   int                `json:"recheck"    validate:"omitempty,gt=0"`
+	Proto     string             `json:"proto"      validate:"required,oneof=tcp udp local unix unixgram journald"`
+	Tag       string             `json:"tag"        validate:"required,gt=0,lte=32"`
+	Facility  cefsyslog.Priority `json:"facility"   validate:"required,oneof=0 8 16 24 32 40 48 56 64 72 80 88"`
+	Format    Format             `json:"format"`
+	Async     *SyslogAsync       `json:"async"      validate:"omitempty"`
+	MaxSize   int                `json:"max_size"   validate:"omitempty,gte=480"`
+	Oversize  string             `json:"oversize"   validate:"omitempty,oneof=truncate split tcp"`
+	Truncate  []string           `json:"truncate"`
+}
+
+// SyslogAsync configures asynchronous batched writes to syslog server
+type SyslogAsync struct {
+	QueueSize     int    `json:"queue_size"     validate:"omitempty,gt=0"`
+	BatchSize     int    `json:"batch_size"     validate:"omitempty,gt=0"`
+	FlushInterval int    `json:"flush_interval" validate:"omitempty,gt=0"`
+	WhenFull      string `json:"when_full"      validate:"omitempty,oneof=block drop"`
+}
+
+// AllAddresses returns address followed by addresses
+func (s *Syslog) AllAddresses() []string {
+	if s.Address == "" {
+		return s.Addresses
+	}
+	return append([]string{s.Address}, s.Addresses...)
+}
+
+// IsRemote returns true if syslog server is reached via network
+func (s *Syslog) IsRemote() bool {
+	return s.Proto == "tcp" || s.Proto == "udp"
+}
+
+// check validates addresses and settings depending on protocol
+func (s *Syslog) check() error {
+	addrs := s.AllAddresses()
+	if s.Proto == SyslogJournald {
+		return s.checkJournald()
+	}
+	if !s.IsRemote() {
+		return nil
+	}
+	if len(addrs) == 0 {
+		return errors.New("syslog address required")
+	}
+	for _, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("syslog address %s: %w", addr, err)
+		}
+	}
+	return nil
+}
+
+// checkJournald rejects settings not applying to journald
+func (s *Syslog) checkJournald() error {
+	if len(s.AllAddresses()) > 1 {
+		return errors.New("journald accepts a single socket path")
+	}
+	var keys []string
+	if s.Mode != "" {
+		keys = append(keys, "mode")
+	}
+	if s.Recheck != 0 {
+		keys = append(keys, "recheck")
+	}
+	if s.Async != nil {
+		keys = append(keys, "async")
+	}
+	if s.MaxSize != 0 {
+		keys = append(keys, "max_size")
+	}
+	if s.Oversize != "" {
+		keys = append(keys, "oversize")
+	}
+	if len(s.Truncate) > 0 {
+		keys = append(keys, "truncate")
+	}
+	if len(keys) > 0 {
+		return fmt.Errorf("not supported by journald: %s", strings.Join(keys, ", "))
+	}
+	return nil
+}
+
+// File configures a file (or StdOut) events are written to line by line
+type File struct {
+	Path   string      `json:"path"   validate:"required"`
+	Format Format      `json:"format"`
+	Rotate *FileRotate `json:"rotate" validate:"omitempty"`
+	Sync   string      `json:"sync"   validate:"omitempty,oneof=none record flush"`
+}
+
+// FileRotate configures rotation of a file output
+type FileRotate struct {
+	MaxSize  int  `json:"max_size"  validate:"omitempty,gt=0"`
+	Interval int  `json:"interval"  validate:"omitempty,gt=0"`
+	MaxFiles int  `json:"max_files" validate:"omitempty,gt=0"`
+	Compress bool `json:"compress"`
+}
+
+// GELF configures a Graylog GELF input
+type GELF struct {
+	Address     string `json:"address"     validate:"required,hostname_port"`
+	Proto       string `json:"proto"       validate:"required,oneof=tcp udp"`
+	Host        string `json:"host"        validate:"omitempty,gt=0"`
+	Compression string `json:"compression" validate:"omitempty,oneof=none gzip zlib"`
+	ChunkSize   int    `json:"chunk_size"  validate:"omitempty,gte=128,lte=65507"`
+}
+
+// Webhook configures an HTTP endpoint events are posted to as JSON or rendered by template
+type Webhook struct {
+	URL             string            `json:"url"              validate:"required,url"`
+	Method          string            `json:"method"           validate:"omitempty,oneof=POST PUT"`
+	Headers         map[string]string `json:"headers"`
+	Secret          string            `json:"secret"`
+	SignatureHeader string            `json:"signature_header"`
+	Timeout         int               `json:"timeout"          validate:"omitempty,gt=0"`
+	Retries         int               `json:"retries"          validate:"omitempty,gte=0"`
+	RetryWait       int               `json:"retry_wait"       validate:"omitempty,gt=0"`
+	BatchSize       int               `json:"batch_size"       validate:"omitempty,gt=0"`
+	Template        string            `json:"template"`
+	ContentType     string            `json:"content_type"`
+	Format          Format            `json:"format"`
+}
+
+// HEC configures a Splunk HTTP Event Collector
+type HEC struct {
+	URL         string `json:"url"          validate:"required,url"`
+	Token       string `json:"token"        validate:"required"`
+	Index       string `json:"index"`
+	Sourcetype  string `json:"sourcetype"`
+	Source      string `json:"source"`
+	Host        string `json:"host"`
+	BatchSize   int    `json:"batch_size"   validate:"omitempty,gt=0"`
+	Ack         bool   `json:"ack"`
+	AckTimeout  int    `json:"ack_timeout"  validate:"omitempty,gt=0"`
+	AckInterval int    `json:"ack_interval" validate:"omitempty,gt=0"`
+	Channel     string `json:"channel"`
+	Timeout     int    `json:"timeout"      validate:"omitempty,gt=0"`
+	Retries     int    `json:"retries"      validate:"omitempty,gte=0"`
+	RetryWait   int    `json:"retry_wait"   validate:"omitempty,gt=0"`
+	Format      Format `json:"format"`
+}
+
+// Kafka configures a Kafka topic events are produced to
+type Kafka struct {
+	Brokers     []string   `json:"brokers"     validate:"required,gt=0,dive,hostname_port"`
+	Topic       string     `json:"topic"       validate:"required"`
+	Key         string     `json:"key"         validate:"omitempty,oneof=userId realmId clientId sessionId ipAddress classId"`
+	Compression string     `json:"compression" validate:"omitempty,oneof=none gzip snappy lz4 zstd"`
+	Acks        string     `json:"acks"        validate:"omitempty,oneof=none leader all"`
+	BatchSize   int        `json:"batch_size"  validate:"omitempty,gt=0"`
+	Timeout     int        `json:"timeout"     validate:"omitempty,gt=0"`
+	SASL        *KafkaSASL `json:"sasl"        validate:"omitempty"`
+	TLS         *KafkaTLS  `json:"tls"         validate:"omitempty"`
+	Format      Format     `json:"format"`
+}
+
+// KafkaSASL configures SASL authentication
+type KafkaSASL struct {
+	Mechanism string `json:"mechanism" validate:"required,oneof=plain scram-sha-256 scram-sha-512"`
+	Username  string `json:"username"  validate:"required"`
+	Password  string `json:"password"  validate:"required"`
+}
+
+// KafkaTLS configures TLS connections to brokers
+type KafkaTLS struct {
+	CAFile   string `json:"ca_file"`
+	CertFile string `json:"cert_file" validate:"required_with=KeyFile"`
+	KeyFile  string `json:"key_file"  validate:"required_with=CertFile"`
+	Insecure bool   `json:"insecure"`
+}
+
+// check validates body format renders JSON unless a template is given
+func (w *Webhook) check() error {
+	if w.Template != "" {
+		return nil
+	}
+	switch w.Format.Type {
+	case "", "json", "ocsf":
+		return nil
+	default:
+		return fmt.Errorf("webhook format must be json or ocsf: %s", w.Format.Type)
+	}
+}
+
+// setOutputs adds top level syslog, file and gelf configuration as outputs and checks output names and routing
+func (c *Config) setOutputs() error {
+	if c.Syslog != nil {
+		c.Outputs = append(c.Outputs, Output{Name: OutputSyslog, Type: OutputSyslog, Syslog: c.Syslog})
+	}
+	if c.File != nil {
+		c.Outputs = append(c.Outputs, Output{Name: OutputFile, Type: OutputFile, File: c.File})
+	}
+	if c.GELF != nil {
+		c.Outputs = append(c.Outputs, Output{Name: OutputGELF, Type: OutputGELF, GELF: c.GELF})
+	}
+	if len(c.Outputs) == 0 {
+		return ErrNoOutput
+	}
+
+	names := map[string]bool{}
+	for _, o := range c.Outputs {
+		if names[o.Name] {
+			return fmt.Errorf("duplicate output name: %s", o.Name)
+		}
+		names[o.Name] = true
+		if err := o.check(); err != nil {
+			return fmt.Errorf("output %s: %w", o.Name, err)
+		}
+	}
+
+	for i := range c.Detections {
+		for _, name := range c.Detections[i].Outputs {
+			if !names[name] {
+				return c.Detections[i].errorf("unknown output: %s", name)
+			}
+		}
+	}
+
+	return nil
+}
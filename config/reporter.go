@@ -16,9 +16,62 @@ package config
 
 import (
 	"github.com/swisslearninghub/logsync/api"
+	"sort"
 	"strings"
 )
 
+// Reporter identifiers
+const (
+	typeType            = "type"
+	typeDetailExists    = "detail_exists"
+	typeDetailNotExists = "detail_not_exists"
+)
+
+// reporterKey describes a configuration key of a reporter type
+type reporterKey struct {
+	name        string
+	description string
+	required    bool
+}
+
+// reporterType holds constructor and configuration keys of a reporter type
+type reporterType struct {
+	new  func(r Reporter) Report
+	keys []reporterKey
+}
+
+// reporterTypes is the registry of available reporters by identifier
+var reporterTypes = map[string]reporterType{
+	typeType: {
+		new: func(r Reporter) Report { return NewTypeReporter(r) },
+		keys: []reporterKey{
+			{name: "type", description: "Event type, i.e. LOGIN", required: true},
+		},
+	},
+	typeDetailExists: {
+		new: func(r Reporter) Report { return NewDetailExistsReporter(r) },
+		keys: []reporterKey{
+			{name: "details", description: "Comma separated event details, any must exist", required: true},
+		},
+	},
+	typeDetailNotExists: {
+		new: func(r Reporter) Report { return NewDetailNotExistsReporter(r) },
+		keys: []reporterKey{
+			{name: "details", description: "Comma separated event details, any must not exist", required: true},
+		},
+	},
+}
+
+// reporterNames returns sorted identifiers of available reporters
+func reporterNames() []string {
+	var names []string
+	for name := range reporterTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Reporter ...
 type Reporter struct {
 	Type   string            `json:"type"`
@@ -0,0 +1,307 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// JSON Schema of configuration generated from JSON keys, validate tags and the reporter registry
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// SchemaDraft is the JSON Schema version of generated schemas
+const SchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+type schema = map[string]interface{}
+
+// schemaGen collects definitions of named struct types while generating a schema
+type schemaGen struct {
+	defs      schema
+	overrides bool // keys may be given by keys suffixed _file or environment variables (see applyOverrides)
+}
+
+// Schema returns JSON Schema of configuration files
+func Schema() map[string]interface{} {
+	g := &schemaGen{defs: schema{}, overrides: true}
+	s := g.object(reflect.TypeOf(Config{}))
+	s["properties"].(schema)["$schema"] = schema{"type": "string"}
+	s["$schema"] = SchemaDraft
+	s["title"] = "logsync configuration"
+	s["definitions"] = g.defs
+	return s
+}
+
+// DetectionsSchema returns JSON Schema of detection files (see includeDetections). Overrides do not apply to them
+func DetectionsSchema() map[string]interface{} {
+	g := &schemaGen{defs: schema{}}
+	list := schema{"type": "array", "items": g.typeOf(reflect.TypeOf(Detection{}))}
+	return schema{
+		"$schema": SchemaDraft,
+		"title":   "logsync detections",
+		"oneOf": []interface{}{
+			list,
+			schema{
+				"type":                 "object",
+				"properties":           schema{"detections": list},
+				"required":             []string{"detections"},
+				"additionalProperties": false,
+			},
+		},
+		"definitions": g.defs,
+	}
+}
+
+// typeOf returns schema of type t. Named structs are referenced by definition
+func (g *schemaGen) typeOf(t reflect.Type) schema {
+	t = indirect(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = schema{}
+			g.defs[t.Name()] = g.object(t)
+		}
+		return schema{"$ref": "#/definitions/" + t.Name()}
+	case reflect.Slice:
+		return schema{"type": "array", "items": g.typeOf(t.Elem())}
+	case reflect.Map:
+		return schema{"type": "object", "additionalProperties": g.typeOf(t.Elem())}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	}
+	return schema{}
+}
+
+// object returns schema of struct type t. If overrides apply, keys suffixed _file hold paths of files containing the
+// value of the key and any value may be set by environment variable. Required keys are then only described, as the
+// schema can not tell whether the environment provides them
+func (g *schemaGen) object(t reflect.Type) schema {
+	props := schema{}
+	deps := schema{}
+	var required []string
+	var conds []interface{}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := jsonKey(f)
+		if key == "" {
+			continue
+		}
+		rules, items := splitRules(f.Tag.Get("validate"))
+		p := g.typeOf(f.Type)
+		constrain(p, rules)
+		if p["type"] == "array" && len(items) > 0 {
+			constrain(p["items"].(schema), items)
+		}
+		props[key] = p
+
+		for _, rule := range rules {
+			name, param := splitRule(rule)
+			switch name {
+			case "required":
+				if g.overrides {
+					describeRequired(p, "required")
+					continue
+				}
+				required = append(required, key)
+			case "required_if":
+				field, value, _ := strings.Cut(param, " ")
+				fkey := fieldKey(t, field)
+				if g.overrides {
+					describeRequired(p, fmt.Sprintf("required if %s is %s", fkey, value))
+					continue
+				}
+				conds = append(conds, schema{
+					"if":   schema{"properties": schema{fkey: schema{"const": value}}, "required": []string{fkey}},
+					"then": schema{"required": []string{key}},
+				})
+			case "required_with":
+				fkey := fieldKey(t, param)
+				if g.overrides {
+					describeRequired(p, "required with "+fkey)
+					continue
+				}
+				dep, _ := deps[fkey].([]string)
+				deps[fkey] = append(dep, key)
+			}
+		}
+	}
+
+	s := schema{
+		"type":                 "object",
+		"properties":           props,
+		"additionalProperties": false,
+	}
+	if g.overrides {
+		s["patternProperties"] = schema{keyFileSuffix + "$": schema{"type": "string"}}
+	}
+	if t == reflect.TypeOf(Reporter{}) {
+		conds = append(conds, reporterConds(props, g.overrides)...)
+	}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	if len(conds) > 0 {
+		s["allOf"] = conds
+	}
+	if len(deps) > 0 {
+		s["dependencies"] = deps
+	}
+	return s
+}
+
+// reporterConds restricts reporter type to registered reporters and config to keys of given type. Required keys are
+// only described if overrides apply
+func reporterConds(props schema, overrides bool) []interface{} {
+	names := reporterNames()
+	props["type"].(schema)["enum"] = names
+
+	var conds []interface{}
+	for _, name := range names {
+		keys := schema{}
+		var required []string
+		for _, k := range reporterTypes[name].keys {
+			key := schema{"type": "string", "description": k.description}
+			keys[k.name] = key
+			switch {
+			case k.required && overrides:
+				key["description"] = k.description + " (required)"
+			case k.required:
+				required = append(required, k.name)
+			}
+		}
+		config := schema{"type": "object", "properties": keys, "additionalProperties": false}
+		then := schema{"properties": schema{"config": config}}
+		if len(required) > 0 {
+			config["required"] = required
+			then["required"] = []string{"config"}
+		}
+		conds = append(conds, schema{
+			"if":   schema{"properties": schema{"type": schema{"const": name}}, "required": []string{"type"}},
+			"then": then,
+		})
+	}
+	return conds
+}
+
+// constrain adds constraints of validate rules to schema p
+func constrain(p schema, rules []string) {
+	for _, rule := range rules {
+		name, param := splitRule(rule)
+		switch name {
+		case "oneof":
+			var enum []interface{}
+			for _, v := range strings.Fields(param) {
+				if n, err := strconv.Atoi(v); err == nil && p["type"] == "integer" {
+					enum = append(enum, n)
+					continue
+				}
+				enum = append(enum, v)
+			}
+			p["enum"] = enum
+		case "gt", "gte", "lt", "lte":
+			n, err := strconv.Atoi(param)
+			if err != nil {
+				continue
+			}
+			constrainRange(p, name, n)
+		case "ne":
+			p["not"] = schema{"const": param}
+		case "url":
+			p["format"] = "uri"
+		case "hostname_port":
+			p["pattern"] = ":[0-9]+$"
+		}
+	}
+}
+
+// constrainRange adds bounds of numbers, lengths of strings or counts of items
+func constrainRange(p schema, name string, n int) {
+	var min, max string
+	switch p["type"] {
+	case "integer", "number":
+		switch name {
+		case "gt":
+			p["exclusiveMinimum"] = n
+		case "gte":
+			p["minimum"] = n
+		case "lt":
+			p["exclusiveMaximum"] = n
+		case "lte":
+			p["maximum"] = n
+		}
+		return
+	case "string":
+		min, max = "minLength", "maxLength"
+	case "array":
+		min, max = "minItems", "maxItems"
+	default:
+		return
+	}
+	switch name {
+	case "gt":
+		p[min] = n + 1
+	case "gte":
+		p[min] = n
+	case "lt":
+		p[max] = n - 1
+	case "lte":
+		p[max] = n
+	}
+}
+
+// splitRules returns validate rules of field and, after dive, of its items
+func splitRules(tag string) (rules, items []string) {
+	if tag == "" {
+		return nil, nil
+	}
+	for i, rule := range strings.Split(tag, ",") {
+		if rule == "dive" {
+			return rules, strings.Split(tag, ",")[i+1:]
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// splitRule returns name and parameter of validate rule
+func splitRule(rule string) (string, string) {
+	name, param, _ := strings.Cut(rule, "=")
+	return name, param
+}
+
+// fieldKey returns JSON key of field name in struct type t
+func fieldKey(t reflect.Type, name string) string {
+	if f, ok := t.FieldByName(name); ok {
+		return jsonKey(f)
+	}
+	return name
+}
+
+// describeRequired describes requirement of a key, which may be met by a _file key or environment variable as well
+func describeRequired(p schema, requirement string) {
+	p["description"] = strings.ToUpper(requirement[:1]) + requirement[1:] + ", in the file or by environment variable"
+}
@@ -0,0 +1,36 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"testing"
+)
+
+func TestSchemaRequired(t *testing.T) {
+	// secret may be given by LOGSYNC_OAUTH2_SECRET only, so it is described but not required
+	oauth2 := Schema()["definitions"].(schema)["OAuth2"].(schema)
+	if _, ok := oauth2["required"]; ok {
+		t.Errorf("configuration schema requires %v", oauth2["required"])
+	}
+	secret := oauth2["properties"].(schema)["secret"].(schema)
+	if secret["description"] == nil {
+		t.Error("requirement of secret not described")
+	}
+
+	detection := DetectionsSchema()["definitions"].(schema)["Detection"].(schema)
+	if required, _ := detection["required"].([]string); len(required) != 3 {
+		t.Errorf("detections schema: got required %v, want class_id, name and reporters", required)
+	}
+}
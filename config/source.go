@@ -0,0 +1,59 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// Sources events are fetched from, i.e. one per hub tenant
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SourceDefault is the name of the source configured by top level oauth2
+const SourceDefault = "default"
+
+var ErrNoSource = errors.New("no source configured")
+
+// OAuth2 configures client credentials and events endpoint of a hub
+type OAuth2 struct {
+	ClientID   string `json:"client_id"   validate:"required,gt=0"`
+	Secret     string `json:"secret"      validate:"required,gt=0"`
+	TokenURL   string `json:"token_url"   validate:"required,url"`
+	ContextURL string `json:"context_url" validate:"required,url"`
+}
+
+// Source is a hub tenant events are fetched from. Name default is reserved for top level oauth2
+type Source struct {
+	Name   string `json:"name"   validate:"required,gt=0,ne=default"`
+	OAuth2 OAuth2 `json:"oauth2"`
+}
+
+// setSources adds top level oauth2 configuration as source and checks source names
+func (c *Config) setSources() error {
+	if c.OAuth2 != nil {
+		c.Sources = append([]Source{{Name: SourceDefault, OAuth2: *c.OAuth2}}, c.Sources...)
+	}
+	if len(c.Sources) == 0 {
+		return ErrNoSource
+	}
+	names := map[string]bool{}
+	for _, s := range c.Sources {
+		if names[s.Name] {
+			return fmt.Errorf("duplicate source name: %s", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+// Prometheus metrics of event fetching, detection and delivery
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "logsync"
+
+// Send results
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// CodeError is used as status code label if a request failed without response
+const CodeError = "error"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	EventsFetched = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_fetched_total",
+		Help:      "Events retrieved from the API.",
+	})
+	EventsPrefiltered = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "events_prefiltered_total",
+		Help:      "Events left after internal prefiltering of client reauthentications.",
+	})
+	Matches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "detection_matches_total",
+		Help:      "Events matched per detection class ID.",
+	}, []string{"class_id"})
+	Sends = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "output_sends_total",
+		Help:      "Records sent per output and result.",
+	}, []string{"output", "result"})
+	APIRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_request_duration_seconds",
+		Help:      "Latency of API requests per status code.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"code"})
+	TokenRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "token_refreshes_total",
+		Help:      "OAuth2 token requests per result.",
+	}, []string{"result"})
+	Reloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "config_reloads_total",
+		Help:      "Configuration reloads per result.",
+	}, []string{"result"})
+	LastSync = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_sync_timestamp_seconds",
+		Help:      "Unix time of last successful sync per source.",
+	}, []string{"source"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		EventsFetched,
+		EventsPrefiltered,
+		Matches,
+		Sends,
+		APIRequestDuration,
+		TokenRefreshes,
+		Reloads,
+		LastSync,
+	)
+}
+
+// Handler returns HTTP handler exposing metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveAPIRequest records latency of an API request started at start. Zero code counts as CodeError
+func ObserveAPIRequest(code int, start time.Time) {
+	label := CodeError
+	if code > 0 {
+		label = strconv.Itoa(code)
+	}
+	APIRequestDuration.WithLabelValues(label).Observe(time.Since(start).Seconds())
+}
+
+// ObserveSend counts result of sending a record to output
+func ObserveSend(output string, err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	Sends.WithLabelValues(output, result).Inc()
+}
+
+// ObserveTokenRefresh counts result of a token request
+func ObserveTokenRefresh(err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	TokenRefreshes.WithLabelValues(result).Inc()
+}
+
+// ObserveReload counts result of a configuration reload
+func ObserveReload(err error) {
+	result := ResultSuccess
+	if err != nil {
+		result = ResultFailure
+	}
+	Reloads.WithLabelValues(result).Inc()
+}
+
+// SetLastSync records time of last successful sync of source
+func SetLastSync(source string, t time.Time) {
+	LastSync.WithLabelValues(source).Set(float64(t.Unix()))
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BatchError is returned by batching or queueing sinks if records could not be sent. It holds all affected records
+type BatchError struct {
+	Records []*Record
+	Err     error
+}
+
+// Error match interface
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("batch of %d record(s) not sent: %s", len(e.Records), e.Err.Error())
+}
+
+// Unwrap returns cause
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// batch collects records until size is reached and passes them to send
+type batch struct {
+	size    int
+	send    func(recs []*Record) error
+	mu      sync.Mutex // guards records
+	records []*Record
+}
+
+// add appends record and sends batch if full
+func (b *batch) add(rec *Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.records = append(b.records, rec)
+	if len(b.records) < b.size {
+		return nil
+	}
+	return b.flush()
+}
+
+// Flush sends collected records
+func (b *batch) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flush()
+}
+
+// flush sends collected records. It must be called with b.mu held.
+func (b *batch) flush() error {
+	if len(b.records) == 0 {
+		return nil
+	}
+	recs := b.records
+	b.records = nil
+	if err := b.send(recs); err != nil {
+		return &BatchError{Records: recs, Err: err}
+	}
+	return nil
+}
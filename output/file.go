@@ -0,0 +1,339 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileStdout is the path used to write to StdOut
+const FileStdout = "-"
+
+// File sync policies
+const (
+	FileSyncNone   = "none"
+	FileSyncRecord = "record"
+	FileSyncFlush  = "flush"
+)
+
+const (
+	filePerm           = 0644
+	fileRotateLayout   = "20060102T150405"
+	fileCompressSuffix = ".gz"
+)
+
+// FileOptions configure rotation and syncing of a FileSink. Zero values disable rotation
+type FileOptions struct {
+	MaxSize  int64         // rotate before file exceeds size in bytes
+	Interval time.Duration // rotate if interval (aligned to UTC) changed since last write
+	MaxFiles int           // rotated files kept, all if zero
+	Compress bool          // gzip rotated files
+	Sync     string        // fsync after each record, on flush or never (default)
+	OnError  func(error)   // called with errors of rotation, compression and retention not preventing writes
+}
+
+// FileSink writes formatted records line by line (i.e. NDJSON) to file or StdOut
+type FileSink struct {
+	mu     sync.Mutex // guards w, file, size and period
+	w      io.Writer
+	path   string
+	file   *os.File
+	format Formatter
+	opts   FileOptions
+	size   int64
+	period time.Time // interval the current file belongs to
+	delivery
+}
+
+// NewFileSink returns Sink. File is created if not already exists, records are appended
+func NewFileSink(path string, format Formatter, opts FileOptions) (*FileSink, error) {
+	switch opts.Sync {
+	case "":
+		opts.Sync = FileSyncNone
+	case FileSyncNone, FileSyncRecord, FileSyncFlush:
+	default:
+		return nil, fmt.Errorf("unknown file sync policy: %s", opts.Sync)
+	}
+	s := &FileSink{path: path, format: format, opts: opts}
+	if path == "" || path == FileStdout {
+		s.w = os.Stdout
+		return s, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Send match interface
+func (s *FileSink) Send(rec *Record) error {
+	msg, err := s.format.Format(rec)
+	if err != nil {
+		return err
+	}
+	line := msg + "\n"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path != "" && s.path != FileStdout {
+		if err = s.prepare(len(line), time.Now()); err != nil {
+			return s.done(err)
+		}
+	}
+	n, err := io.WriteString(s.w, line)
+	s.size += int64(n)
+	if err == nil && s.file != nil && s.opts.Sync == FileSyncRecord {
+		err = s.file.Sync()
+	}
+	return s.done(err)
+}
+
+// Flush match interface
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil && s.opts.Sync != FileSyncNone {
+		return s.done(s.file.Sync())
+	}
+	return nil
+}
+
+// Close match interface
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file != nil {
+		if s.opts.Sync != FileSyncNone {
+			_ = s.file.Sync()
+		}
+		err := s.file.Close()
+		s.file = nil
+		return err
+	}
+	return nil
+}
+
+// open opens file for appending. A file left from an earlier interval is rotated first.
+// It must be called with s.mu held.
+func (s *FileSink) open() error {
+	modified, err := s.reopen()
+	if err != nil {
+		return err
+	}
+	if s.size > 0 && s.opts.Interval > 0 && !s.periodOf(modified).Equal(s.period) {
+		return s.rotate()
+	}
+	return nil
+}
+
+// reopen opens file at path for appending and returns its modification time. It must be called with s.mu held.
+func (s *FileSink) reopen() (time.Time, error) {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePerm)
+	if err != nil {
+		return time.Time{}, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return time.Time{}, err
+	}
+	s.file = f
+	s.w = f
+	s.size = fi.Size()
+	s.period = s.periodOf(time.Now())
+	return fi.ModTime(), nil
+}
+
+// prepare reopens file closed by a failed rotation or rotates file if due before writing n bytes at now. It must be
+// called with s.mu held.
+func (s *FileSink) prepare(n int, now time.Time) error {
+	if s.file == nil {
+		_, err := s.reopen()
+		return err
+	}
+	if s.due(n, now) {
+		return s.rotate()
+	}
+	return nil
+}
+
+// due returns true if file must be rotated before writing n bytes at now. It must be called with s.mu held.
+func (s *FileSink) due(n int, now time.Time) bool {
+	if s.size == 0 {
+		return false
+	}
+	if s.opts.MaxSize > 0 && s.size+int64(n) > s.opts.MaxSize {
+		return true
+	}
+	return s.opts.Interval > 0 && !s.period.Equal(s.periodOf(now))
+}
+
+// periodOf returns start of interval t belongs to
+func (s *FileSink) periodOf(t time.Time) time.Time {
+	if s.opts.Interval <= 0 {
+		return time.Time{}
+	}
+	return t.UTC().Truncate(s.opts.Interval)
+}
+
+// rotate renames current file, optionally compresses it, removes files exceeding retention and opens a new file.
+// The file at path is reopened in any case, so records are still written if renaming failed. Rotation is retried
+// once due again, errors not preventing writes are passed to OnError. It must be called with s.mu held.
+func (s *FileSink) rotate() error {
+	if s.opts.Sync != FileSyncNone {
+		_ = s.file.Sync()
+	}
+	err := s.file.Close()
+	s.file = nil
+
+	var name string
+	if err == nil {
+		name = s.rotatedName(time.Now())
+		err = os.Rename(s.path, name)
+	}
+	if _, errOpen := s.reopen(); errOpen != nil {
+		return errOpen
+	}
+	if err != nil {
+		s.rotateError(fmt.Errorf("rotate %s: %w", s.path, err))
+		return nil
+	}
+
+	if s.opts.Compress {
+		if err = compressFile(name); err != nil {
+			s.rotateError(fmt.Errorf("compress %s: %w", name, err))
+		}
+	}
+	if err = s.prune(); err != nil {
+		s.rotateError(fmt.Errorf("prune %s: %w", s.path, err))
+	}
+	return nil
+}
+
+// rotateError passes err to configured handler
+func (s *FileSink) rotateError(err error) {
+	if s.opts.OnError != nil {
+		s.opts.OnError(err)
+	}
+}
+
+// rotatedName returns unused name for rotated file. The sequence follows the highest one of files rotated at the same
+// time, so names freed by retention are not reused and rotated files keep sorting oldest first
+func (s *FileSink) rotatedName(t time.Time) string {
+	stamp := t.UTC().Format(fileRotateLayout)
+	base := s.path + "." + stamp
+	names, _ := filepath.Glob(base + "*")
+	last := -1
+	for _, name := range names {
+		if st, seq := rotatedStamp(s.path, name); st == stamp && seq > last {
+			last = seq
+		}
+	}
+	if last < 0 {
+		return base
+	}
+	return fmt.Sprintf("%s.%d", base, last+1)
+}
+
+// prune removes oldest rotated files exceeding retention count
+func (s *FileSink) prune() error {
+	if s.opts.MaxFiles <= 0 {
+		return nil
+	}
+	names, err := filepath.Glob(s.path + ".*")
+	if err != nil {
+		return err
+	}
+	var rotated []string
+	for _, name := range names {
+		if stamp, _ := rotatedStamp(s.path, name); stamp != "" {
+			rotated = append(rotated, name)
+		}
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		si, ni := rotatedStamp(s.path, rotated[i])
+		sj, nj := rotatedStamp(s.path, rotated[j])
+		if si != sj {
+			return si < sj
+		}
+		return ni < nj
+	})
+	for len(rotated) > s.opts.MaxFiles {
+		if err = os.Remove(rotated[0]); err != nil {
+			return err
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// rotatedStamp returns timestamp and sequence of a rotated file name. Timestamp is empty for other files
+func rotatedStamp(path, name string) (string, int) {
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, path+"."), fileCompressSuffix), ".")
+	if _, err := time.Parse(fileRotateLayout, parts[0]); err != nil || len(parts) > 2 {
+		return "", 0
+	}
+	if len(parts) == 1 {
+		return parts[0], 0
+	}
+	seq, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0
+	}
+	return parts[0], seq
+}
+
+// compressFile replaces file by gzip compressed file with suffix .gz
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = src.Close() }()
+
+	dst, err := os.OpenFile(name+fileCompressSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, filePerm)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if errClose := dst.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		_ = os.Remove(name + fileCompressSuffix)
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,268 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sourceFormat renders records as their source
+type sourceFormat struct{}
+
+// Format match interface
+func (f sourceFormat) Format(rec *Record) (string, error) {
+	return rec.Source, nil
+}
+
+// readLines returns lines of file
+func readLines(t *testing.T, name string) []string {
+	bs, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(bs), "\n"), "\n")
+}
+
+// sendLines sends records of given sources
+func sendLines(t *testing.T, sink *FileSink, sources ...string) {
+	for _, source := range sources {
+		if err := sink.Send(&Record{Source: source}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// rotatedFiles returns contents of rotated files oldest first, decompressed if compressed
+func rotatedFiles(t *testing.T, path string) []string {
+	names, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		si, ni := rotatedStamp(path, names[i])
+		sj, nj := rotatedStamp(path, names[j])
+		if si != sj {
+			return si < sj
+		}
+		return ni < nj
+	})
+	var contents []string
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = f
+		if strings.HasSuffix(name, fileCompressSuffix) {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		bs, err := io.ReadAll(r)
+		_ = f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		contents = append(contents, string(bs))
+	}
+	return contents
+}
+
+func TestFileSinkNDJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	f, err := NewJSONFormatter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, eventType := range []string{"LOGIN", "LOGOUT"} {
+		// file is appended to when opened again
+		sink, err := NewFileSink(path, f, FileOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = sink.Send(testRecord(eventType)); err != nil {
+			t.Fatal(err)
+		}
+		if err = sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lines := readLines(t, path)
+	if len(lines) != 2 {
+		t.Fatalf("got %d line(s), want 2", len(lines))
+	}
+	for i, want := range []string{"LOGIN", "LOGOUT"} {
+		var doc jsonRecord
+		if err = json.Unmarshal([]byte(lines[i]), &doc); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if doc.ClassID != want {
+			t.Errorf("line %d: got class id %s, want %s", i+1, doc.ClassID, want)
+		}
+	}
+}
+
+func TestFileRotateSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	sink, err := NewFileSink(path, sourceFormat{}, FileOptions{MaxSize: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sink.Close() }()
+
+	// two lines of 2 bytes fit, a line exceeding size on its own is still written
+	sendLines(t, sink, "1", "2", "3", "4", "long", "5")
+	if got := rotatedFiles(t, path); strings.Join(got, "|") != "1\n2\n|3\n4\n|long\n" {
+		t.Errorf("got rotated files %q", got)
+	}
+	if got := readLines(t, path); len(got) != 1 || got[0] != "5" {
+		t.Errorf("got current file %q, want [5]", got)
+	}
+}
+
+func TestFileRetention(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "out.log")
+		var errs []error
+		sink, err := NewFileSink(path, sourceFormat{}, FileOptions{
+			MaxSize:  2,
+			MaxFiles: 2,
+			Compress: compress,
+			OnError:  func(err error) { errs = append(errs, err) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 1; i <= 5; i++ {
+			sendLines(t, sink, strconv.Itoa(i))
+		}
+		_ = sink.Close()
+
+		if got := rotatedFiles(t, path); strings.Join(got, "|") != "3\n|4\n" {
+			t.Errorf("compress %v: got rotated files %q, want newest two", compress, got)
+		}
+		if compress {
+			if names, _ := filepath.Glob(path + ".*[0-9]"); len(names) != 0 {
+				t.Errorf("got uncompressed rotated files %v", names)
+			}
+		}
+		if len(errs) != 0 {
+			t.Errorf("compress %v: got errors %v", compress, errs)
+		}
+	}
+}
+
+func TestFileRotateInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	sink, err := NewFileSink(path, sourceFormat{}, FileOptions{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sendLines(t, sink, "1", "2")
+	if got := rotatedFiles(t, path); len(got) != 0 {
+		t.Errorf("got rotated files %q within interval", got)
+	}
+
+	// next interval started
+	sink.period = sink.period.Add(-time.Hour)
+	sendLines(t, sink, "3")
+	if got := rotatedFiles(t, path); strings.Join(got, "|") != "1\n2\n" {
+		t.Errorf("got rotated files %q, want file of previous interval", got)
+	}
+	_ = sink.Close()
+
+	// file left from an earlier interval is rotated when opened
+	old := time.Now().Add(-2 * time.Hour)
+	if err = os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if sink, err = NewFileSink(path, sourceFormat{}, FileOptions{Interval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sink.Close() }()
+	if got := rotatedFiles(t, path); strings.Join(got, "|") != "1\n2\n|3\n" {
+		t.Errorf("got rotated files %q, want file of earlier interval rotated on open", got)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != 0 {
+		t.Errorf("got current file %v, %v, want empty", fi, err)
+	}
+}
+
+func TestFileSync(t *testing.T) {
+	if _, err := NewFileSink(filepath.Join(t.TempDir(), "out.log"), sourceFormat{}, FileOptions{Sync: "always"}); err == nil {
+		t.Error("got no error for unknown sync policy")
+	}
+
+	tests := []struct {
+		sync     string
+		sendErr  bool
+		flushErr bool
+	}{
+		{FileSyncNone, false, false},
+		{FileSyncFlush, false, true},
+		{FileSyncRecord, true, true},
+	}
+	for _, tt := range tests {
+		sink, err := NewFileSink(filepath.Join(t.TempDir(), "out.log"), sourceFormat{}, FileOptions{Sync: tt.sync})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sendLines(t, sink, "1")
+		if err = sink.Flush(); err != nil {
+			t.Fatalf("%s: %v", tt.sync, err)
+		}
+
+		// sync of closed file fails, records are still written
+		_ = sink.file.Close()
+		sink.w = io.Discard
+		if err = sink.Send(&Record{Source: "2"}); (err != nil) != tt.sendErr {
+			t.Errorf("%s: send got %v, want error %v", tt.sync, err, tt.sendErr)
+		}
+		if err = sink.Flush(); (err != nil) != tt.flushErr {
+			t.Errorf("%s: flush got %v, want error %v", tt.sync, err, tt.flushErr)
+		}
+	}
+}
+
+func TestRotatedStamp(t *testing.T) {
+	tests := []struct {
+		name  string
+		stamp string
+		seq   int
+	}{
+		{"out.log.20230504T130203", "20230504T130203", 0},
+		{"out.log.20230504T130203.2", "20230504T130203", 2},
+		{"out.log.20230504T130203.2.gz", "20230504T130203", 2},
+		{"out.log.20230504T130203.gz", "20230504T130203", 0},
+		{"out.log.bak", "", 0},
+		{"out.log.20230504T130203.x", "", 0},
+		{"out.log.20230504T130203.1.2", "", 0},
+	}
+	for _, tt := range tests {
+		if stamp, seq := rotatedStamp("out.log", tt.name); stamp != tt.stamp || seq != tt.seq {
+			t.Errorf("%s: got %q, %d, want %q, %d", tt.name, stamp, seq, tt.stamp, tt.seq)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"time"
+)
+
+// Format identifiers
+const (
+	FormatCEF  = "cef"
+	FormatLEEF = "leef"
+	FormatJSON = "json"
+	FormatOCSF = "ocsf"
+)
+
+// Record is a reported event as produced by a detection
+type Record struct {
+	Time     time.Time                `json:"time"`
+	LogLevel cefsyslog.Priority       `json:"loglevel"`
+	CEF      *cefsyslog.CEF           `json:"cef"`
+	Event    *api.EventRepresentation `json:"event"`
+	Source   string                   `json:"source,omitempty"`
+}
+
+// Formatter renders a record to a message
+type Formatter interface {
+	Format(rec *Record) (string, error)
+}
+
+// NewFormatter returns Formatter for given format identifier and configuration. Empty format defaults to CEF
+func NewFormatter(format string, cfg map[string]string) (Formatter, error) {
+	switch format {
+	case "", FormatCEF:
+		return new(CEFFormatter), nil
+	case FormatLEEF:
+		return NewLEEFFormatter(cfg)
+	case FormatJSON:
+		return NewJSONFormatter(cfg)
+	case FormatOCSF:
+		return new(OCSFFormatter), nil
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// CEFFormatter renders records as CEF
+type CEFFormatter struct{}
+
+// Format match interface
+func (f *CEFFormatter) Format(rec *Record) (string, error) {
+	return rec.CEF.String(), nil
+}
@@ -0,0 +1,263 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const gelfVersion = "1.1"
+
+// GELF compression identifiers
+const (
+	GELFCompressionNone = "none"
+	GELFCompressionGzip = "gzip"
+	GELFCompressionZlib = "zlib"
+)
+
+// GELF chunking (UDP only)
+const (
+	gelfChunkSizeDefault = 1420
+	gelfChunkSizeMin     = 128
+	gelfChunkMax         = 128
+	gelfChunkHeaderSize  = 12
+	gelfMessageIDSize    = 8
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// gelfFieldInvalid matches characters not allowed in additional field names
+var gelfFieldInvalid = regexp.MustCompile(`[^\w.\-]`)
+
+var ErrGELFTooManyChunks = errors.New("gelf message exceeds maximum chunk count")
+
+// GELFSink sends records as GELF 1.1 messages to Graylog via UDP (optionally compressed and chunked) or TCP
+type GELFSink struct {
+	network     string
+	raddr       string
+	host        string
+	compression string
+	chunkSize   int
+	mu          sync.Mutex // guards conn
+	conn        net.Conn
+	delivery
+}
+
+// NewGELFSink returns Sink connected to raddr. Hostname is used if host is empty
+func NewGELFSink(network, raddr, host, compression string, chunkSize int) (*GELFSink, error) {
+	switch network {
+	case "udp":
+	case "tcp":
+		if compression != "" && compression != GELFCompressionNone {
+			return nil, errors.New("gelf compression is not supported over tcp")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported gelf network: %s", network)
+	}
+	switch compression {
+	case "", GELFCompressionNone, GELFCompressionGzip, GELFCompressionZlib:
+	default:
+		return nil, fmt.Errorf("unsupported gelf compression: %s", compression)
+	}
+	if chunkSize == 0 {
+		chunkSize = gelfChunkSizeDefault
+	}
+	if chunkSize < gelfChunkSizeMin {
+		return nil, fmt.Errorf("gelf chunk size must be at least %d", gelfChunkSizeMin)
+	}
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+
+	s := &GELFSink{
+		network:     network,
+		raddr:       raddr,
+		host:        host,
+		compression: compression,
+		chunkSize:   chunkSize,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Send match interface
+func (s *GELFSink) Send(rec *Record) error {
+	bs, err := json.Marshal(s.message(rec))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		if err = s.write(bs); err == nil {
+			return s.done(nil)
+		}
+	}
+	if err = s.connect(); err != nil {
+		return s.done(err)
+	}
+	return s.done(s.write(bs))
+}
+
+// Close match interface
+func (s *GELFSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		err := s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// message returns GELF message with additional fields from record header, event attributes and details
+func (s *GELFSink) message(rec *Record) map[string]interface{} {
+	m := map[string]interface{}{
+		"version":       gelfVersion,
+		"host":          s.host,
+		"short_message": rec.CEF.Name,
+		"timestamp":     float64(rec.Time.UnixMilli()) / float64(time.Second/time.Millisecond),
+		"level":         rec.LogLevel,
+		"_class_id":     rec.CEF.EventClassID,
+		"_severity":     rec.CEF.Severity,
+		"_vendor":       rec.CEF.DeviceVendor,
+		"_product":      rec.CEF.DeviceProduct,
+		"_version":      rec.CEF.DeviceVersion,
+	}
+	er := rec.Event
+	if er == nil {
+		return m
+	}
+	for key, value := range map[string]*string{
+		"_event_type": er.Type,
+		"_realm_id":   er.RealmID,
+		"_client_id":  er.ClientID,
+		"_user_id":    er.UserID,
+		"_session_id": er.SessionID,
+		"_ip_address": er.IPAddress,
+	} {
+		if value != nil {
+			m[key] = *value
+		}
+	}
+	for key, value := range er.Details {
+		m["_detail_"+gelfFieldInvalid.ReplaceAllString(key, "_")] = value
+	}
+	return m
+}
+
+// connect makes a connection to the GELF input. It must be called with s.mu held.
+func (s *GELFSink) connect() error {
+	if s.conn != nil {
+		// ignore err from close, it makes sense to continue anyway
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	c, err := net.Dial(s.network, s.raddr)
+	if err != nil {
+		return err
+	}
+	s.conn = c
+	return nil
+}
+
+// write sends message null byte delimited via TCP or compressed and chunked via UDP. It must be called with s.mu held.
+func (s *GELFSink) write(bs []byte) error {
+	if s.network == "tcp" {
+		_, err := s.conn.Write(append(bs, 0))
+		return err
+	}
+	bs, err := s.compress(bs)
+	if err != nil {
+		return err
+	}
+	if len(bs) <= s.chunkSize {
+		_, err = s.conn.Write(bs)
+		return err
+	}
+	return s.writeChunked(bs)
+}
+
+// writeChunked splits message into GELF chunks. It must be called with s.mu held.
+func (s *GELFSink) writeChunked(bs []byte) error {
+	size := s.chunkSize - gelfChunkHeaderSize
+	count := (len(bs) + size - 1) / size
+	if count > gelfChunkMax {
+		return fmt.Errorf("%w: %d", ErrGELFTooManyChunks, count)
+	}
+	id := make([]byte, gelfMessageIDSize)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	for seq := 0; seq < count; seq++ {
+		end := (seq + 1) * size
+		if end > len(bs) {
+			end = len(bs)
+		}
+		var chunk bytes.Buffer
+		chunk.Write(gelfChunkMagic)
+		chunk.Write(id)
+		chunk.WriteByte(byte(seq))
+		chunk.WriteByte(byte(count))
+		chunk.Write(bs[seq*size : end])
+		if _, err := s.conn.Write(chunk.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress returns message compressed as configured
+func (s *GELFSink) compress(bs []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch s.compression {
+	case GELFCompressionGzip:
+		w = gzip.NewWriter(&buf)
+	case GELFCompressionZlib:
+		w = zlib.NewWriter(&buf)
+	default:
+		return bs, nil
+	}
+	if _, err := w.Write(bs); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+)
+
+// gelfRecord returns record with a detail of size random letters, so compression does not avoid chunking
+func gelfRecord(size int) *Record {
+	rnd := rand.New(rand.NewSource(1))
+	detail := make([]byte, size)
+	for i := range detail {
+		detail[i] = byte('a' + rnd.Intn(26))
+	}
+	rec := testRecord("LOGIN")
+	rec.Event.Details["user agent"] = string(detail)
+	return rec
+}
+
+// listenGELFUDP returns address of a GELF UDP input and a function reading count datagrams
+func listenGELFUDP(t *testing.T) (string, func(count int) [][]byte) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn.LocalAddr().String(), func(count int) [][]byte {
+		var packets [][]byte
+		buf := make([]byte, 65536)
+		for len(packets) < count {
+			_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				t.Fatalf("got %d of %d datagram(s): %v", len(packets), count, err)
+			}
+			packets = append(packets, append([]byte(nil), buf[:n]...))
+		}
+		return packets
+	}
+}
+
+// decompressed returns payload decompressed as given
+func decompressed(t *testing.T, compression string, bs []byte) []byte {
+	var r io.Reader
+	var err error
+	switch compression {
+	case GELFCompressionGzip:
+		r, err = gzip.NewReader(bytes.NewReader(bs))
+	case GELFCompressionZlib:
+		r, err = zlib.NewReader(bytes.NewReader(bs))
+	default:
+		return bs
+	}
+	if err == nil {
+		bs, err = io.ReadAll(r)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bs
+}
+
+func TestGELFMessage(t *testing.T) {
+	s := &GELFSink{host: "host"}
+	bs, err := json.Marshal(s.message(gelfRecord(1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"_class_id":"LOGIN","_client_id":"client","_detail_user_agent":"x","_detail_username":"jdoe",` +
+		`"_event_type":"LOGIN","_ip_address":"10.0.0.1","_product":"LMS","_realm_id":"realm","_session_id":"sid",` +
+		`"_severity":4,"_user_id":"uid","_vendor":"Swiss Learning Hub AG","_version":"1.0.0","host":"host",` +
+		`"level":5,"short_message":"Event LOGIN","timestamp":1683205323.045,"version":"1.1"}`
+	if string(bs) != want {
+		t.Errorf("\ngot  %s\nwant %s", bs, want)
+	}
+}
+
+func TestGELFUDPChunked(t *testing.T) {
+	for _, compression := range []string{GELFCompressionNone, GELFCompressionGzip, GELFCompressionZlib} {
+		addr, read := listenGELFUDP(t)
+		sink, err := NewGELFSink("udp", addr, "host", compression, 512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := gelfRecord(3000)
+		want, _ := json.Marshal(sink.message(rec))
+
+		// small messages are sent in a single datagram
+		if err = sink.Send(gelfRecord(1)); err != nil {
+			t.Fatal(err)
+		}
+		if single := read(1)[0]; bytes.HasPrefix(single, gelfChunkMagic) {
+			t.Errorf("%s: got chunked datagram for small message", compression)
+		}
+
+		if err = sink.Send(rec); err != nil {
+			t.Fatal(err)
+		}
+		first := read(1)[0]
+		if !bytes.HasPrefix(first, gelfChunkMagic) {
+			t.Fatalf("%s: got datagram without chunk magic", compression)
+		}
+		count := int(first[11])
+		chunks := append([][]byte{first}, read(count-1)...)
+
+		var payload []byte
+		for i, chunk := range chunks {
+			if len(chunk) > 512 {
+				t.Errorf("%s: chunk %d of %d bytes exceeds chunk size", compression, i, len(chunk))
+			}
+			if !bytes.Equal(chunk[2:10], first[2:10]) || int(chunk[10]) != i || int(chunk[11]) != count {
+				t.Errorf("%s: chunk %d has header % x", compression, i, chunk[:gelfChunkHeaderSize])
+			}
+			payload = append(payload, chunk[gelfChunkHeaderSize:]...)
+		}
+		if got := decompressed(t, compression, payload); !bytes.Equal(got, want) {
+			t.Errorf("%s: reassembled chunks differ from message", compression)
+		}
+		_ = sink.Close()
+	}
+}
+
+func TestGELFTooManyChunks(t *testing.T) {
+	addr, _ := listenGELFUDP(t)
+	sink, err := NewGELFSink("udp", addr, "host", GELFCompressionNone, gelfChunkSizeMin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sink.Close() }()
+	size := gelfChunkMax * (gelfChunkSizeMin - gelfChunkHeaderSize)
+	if err = sink.Send(gelfRecord(size)); !errors.Is(err, ErrGELFTooManyChunks) {
+		t.Errorf("got %v, want %v", err, ErrGELFTooManyChunks)
+	}
+}
+
+func TestGELFTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	messages := make(chan []byte, 2)
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		r := bufio.NewReader(c)
+		for {
+			bs, err := r.ReadBytes(0)
+			if err != nil {
+				return
+			}
+			messages <- bs
+		}
+	}()
+
+	sink, err := NewGELFSink("tcp", l.Addr().String(), "host", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = sink.Close() }()
+	for i := 0; i < 2; i++ {
+		if err = sink.Send(gelfRecord(2000)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case bs := <-messages:
+			var m map[string]interface{}
+			if err = json.Unmarshal(bytes.TrimSuffix(bs, []byte{0}), &m); err != nil || m["short_message"] != "Event LOGIN" {
+				t.Errorf("message %d: got %v, %s", i, err, bs)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("got %d of 2 messages", i)
+		}
+	}
+}
+
+func TestGELFInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		network, compression string
+		chunkSize            int
+	}{
+		{"tcp", GELFCompressionGzip, 0},
+		{"udp", "brotli", 0},
+		{"udp", "", gelfChunkSizeMin - 1},
+		{"unix", "", 0},
+	} {
+		if _, err := NewGELFSink(tt.network, "127.0.0.1:12201", "host", tt.compression, tt.chunkSize); err == nil {
+			t.Errorf("%+v: got no error", tt)
+		}
+	}
+}
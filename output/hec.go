@@ -0,0 +1,243 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+// Splunk HTTP Event Collector, see https://docs.splunk.com/Documentation/Splunk/latest/Data/HECRESTendpoints
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HEC endpoints and defaults
+const (
+	hecEventPath          = "/services/collector/event"
+	hecAckPath            = "/services/collector/ack"
+	hecChannelHeader      = "X-Splunk-Request-Channel"
+	HECAckTimeoutDefault  = time.Minute
+	HECAckIntervalDefault = time.Second
+)
+
+var ErrHECAckTimeout = errors.New("hec indexer acknowledgement timeout")
+
+// HECOptions configure a HECSink
+type HECOptions struct {
+	URL         string // base URL of HEC, i.e. https://splunk:8088
+	Token       string
+	Index       string
+	Sourcetype  string
+	Source      string
+	Host        string
+	BatchSize   int  // events per request, single event requests if less than 2
+	Ack         bool // wait for indexer acknowledgement
+	AckTimeout  time.Duration
+	AckInterval time.Duration
+	Channel     string // request channel, generated if empty
+	Timeout     time.Duration
+	Retries     int
+	RetryWait   time.Duration
+	Context     context.Context // waits for retries and acknowledgements give up once done (optional)
+}
+
+// HECSink sends records to Splunk HTTP Event Collector
+type HECSink struct {
+	opts   HECOptions
+	format Formatter
+	http   *httpRetry
+	batch  *batch
+	delivery
+}
+
+// hecEvent is the HEC representation of a record
+type hecEvent struct {
+	Time       float64     `json:"time"`
+	Host       string      `json:"host,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	Sourcetype string      `json:"sourcetype,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Event      interface{} `json:"event"`
+}
+
+// hecResponse is the response of event and ack endpoints
+type hecResponse struct {
+	Text  string          `json:"text"`
+	Code  int             `json:"code"`
+	AckID *int64          `json:"ackId"`
+	Acks  map[string]bool `json:"acks"`
+}
+
+// NewHECSink returns Sink. Formatted records are sent as JSON object if format renders JSON, as string otherwise
+func NewHECSink(opts HECOptions, format Formatter) (*HECSink, error) {
+	opts.URL = strings.TrimSuffix(strings.TrimSuffix(opts.URL, "/"), hecEventPath)
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = HECAckTimeoutDefault
+	}
+	if opts.AckInterval <= 0 {
+		opts.AckInterval = HECAckIntervalDefault
+	}
+	if opts.Ack && opts.Channel == "" {
+		var err error
+		if opts.Channel, err = newChannel(); err != nil {
+			return nil, err
+		}
+	}
+	s := &HECSink{
+		opts:   opts,
+		format: format,
+		http:   newHTTPRetry(opts.Context, opts.Timeout, opts.Retries, opts.RetryWait),
+	}
+	if opts.BatchSize > 1 {
+		s.batch = &batch{size: opts.BatchSize, send: s.post}
+	}
+	return s, nil
+}
+
+// Send match interface
+func (s *HECSink) Send(rec *Record) error {
+	if s.batch != nil {
+		return s.batch.add(rec)
+	}
+	return s.post([]*Record{rec})
+}
+
+// Flush match interface
+func (s *HECSink) Flush() error {
+	if s.batch != nil {
+		return s.batch.Flush()
+	}
+	return nil
+}
+
+// Close match interface. Remaining records are sent
+func (s *HECSink) Close() error {
+	return s.Flush()
+}
+
+// post sends records in a single request and waits for acknowledgement if configured
+func (s *HECSink) post(recs []*Record) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, rec := range recs {
+		ev, err := s.event(rec)
+		if err != nil {
+			return err
+		}
+		if err = enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	resp, err := s.request(hecEventPath, body.Bytes())
+	if err != nil || !s.opts.Ack {
+		return s.done(err)
+	}
+	if resp.AckID == nil {
+		return s.done(errors.New("hec indexer acknowledgement not enabled for token"))
+	}
+	return s.done(s.waitAck(*resp.AckID))
+}
+
+// event returns HEC event of record. Time is taken from event if present
+func (s *HECSink) event(rec *Record) (*hecEvent, error) {
+	msg, err := s.format.Format(rec)
+	if err != nil {
+		return nil, err
+	}
+	ev := &hecEvent{
+		Time:       float64(rec.Time.UnixMilli()) / float64(time.Second/time.Millisecond),
+		Host:       s.opts.Host,
+		Source:     s.opts.Source,
+		Sourcetype: s.opts.Sourcetype,
+		Index:      s.opts.Index,
+		Event:      msg,
+	}
+	if rec.Event != nil {
+		ev.Time = float64(rec.Event.Time) / float64(time.Second/time.Millisecond)
+	}
+	if json.Valid([]byte(msg)) {
+		ev.Event = json.RawMessage(msg)
+	}
+	return ev, nil
+}
+
+// waitAck polls acknowledgement of ackID until indexed or timeout. Once context is done, it is polled a last time
+// without waiting
+func (s *HECSink) waitAck(ackID int64) error {
+	body, err := json.Marshal(map[string][]int64{"acks": {ackID}})
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(s.opts.AckTimeout)
+	for {
+		errWait := s.http.sleep(s.opts.AckInterval)
+		resp, err := s.request(hecAckPath, body)
+		if err != nil {
+			return err
+		}
+		if resp.Acks[fmt.Sprintf("%d", ackID)] {
+			return nil
+		}
+		if errWait != nil {
+			return fmt.Errorf("ack %d: %w", ackID, errWait)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w: ack %d", ErrHECAckTimeout, ackID)
+		}
+	}
+}
+
+// request posts body to HEC endpoint path and returns decoded response
+func (s *HECSink) request(path string, body []byte) (*hecResponse, error) {
+	bs, err := s.http.do(func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, s.opts.URL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Splunk "+s.opts.Token)
+		req.Header.Set("Content-Type", "application/json")
+		if s.opts.Channel != "" {
+			req.Header.Set(hecChannelHeader, s.opts.Channel)
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := new(hecResponse)
+	if err = json.Unmarshal(bs, resp); err != nil {
+		return nil, fmt.Errorf("hec response: %w", err)
+	}
+	if resp.Code != 0 {
+		return nil, fmt.Errorf("hec code %d: %s", resp.Code, resp.Text)
+	}
+	return resp, nil
+}
+
+// newChannel returns a random UUID used as request channel
+func newChannel() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
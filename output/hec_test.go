@@ -0,0 +1,279 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/swisslearninghub/logsync/api"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testFormat renders every record as the same message
+type testFormat string
+
+// Format match interface
+func (f testFormat) Format(*Record) (string, error) {
+	return string(f), nil
+}
+
+// hecStandIn is a local HTTP Event Collector recording received requests
+type hecStandIn struct {
+	t       *testing.T
+	server  *httptest.Server
+	mu      sync.Mutex
+	events  [][]map[string]interface{} // events per request
+	headers []http.Header
+	ackPoll int // ack polls answered with false before acknowledging
+	polls   int
+}
+
+// newHECStandIn starts stand-in, closed at end of test
+func newHECStandIn(t *testing.T) *hecStandIn {
+	h := &hecStandIn{t: t}
+	h.server = httptest.NewServer(http.HandlerFunc(h.handle))
+	t.Cleanup(h.server.Close)
+	return h
+}
+
+// handle answers event and ack requests
+func (h *hecStandIn) handle(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	bs, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.t.Errorf("read body: %v", err)
+		return
+	}
+	switch r.URL.Path {
+	case hecEventPath:
+		var events []map[string]interface{}
+		sc := bufio.NewScanner(bytes.NewReader(bs))
+		for sc.Scan() {
+			ev := map[string]interface{}{}
+			if err = json.Unmarshal(sc.Bytes(), &ev); err != nil {
+				h.t.Errorf("decode event: %v", err)
+			}
+			events = append(events, ev)
+		}
+		h.events = append(h.events, events)
+		h.headers = append(h.headers, r.Header.Clone())
+		_, _ = fmt.Fprintf(w, `{"text":"Success","code":0,"ackId":%d}`, len(h.events))
+	case hecAckPath:
+		h.polls++
+		var req struct {
+			Acks []int64 `json:"acks"`
+		}
+		if err = json.Unmarshal(bs, &req); err != nil || len(req.Acks) != 1 {
+			h.t.Errorf("ack request %s: %v", bs, err)
+		}
+		acked := h.ackPoll >= 0 && h.polls > h.ackPoll
+		_, _ = fmt.Fprintf(w, `{"acks":{"%d":%v}}`, req.Acks[0], acked)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// requests returns copy of events received per request
+func (h *hecStandIn) requests() [][]map[string]interface{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([][]map[string]interface{}{}, h.events...)
+}
+
+func TestHECBatch(t *testing.T) {
+	h := newHECStandIn(t)
+	sink, err := NewHECSink(HECOptions{URL: h.server.URL, Token: "tok", BatchSize: 2}, testFormat("msg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = sink.Send(&Record{Time: time.Now()}); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	if n := len(h.requests()); n != 1 {
+		t.Fatalf("requests before flush: got %d, want 1", n)
+	}
+	if err = sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reqs := h.requests()
+	if len(reqs) != 2 || len(reqs[0]) != 2 || len(reqs[1]) != 1 {
+		t.Fatalf("events per request: got %v, want [2 1]", reqs)
+	}
+}
+
+func TestHECBatchError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"text":"Invalid token","code":4}`))
+	}))
+	defer server.Close()
+
+	sink, err := NewHECSink(HECOptions{URL: server.URL, BatchSize: 2}, testFormat("msg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Send(&Record{}); err != nil {
+		t.Fatal(err)
+	}
+	err = sink.Send(&Record{})
+	var be *BatchError
+	if !errors.As(err, &be) || len(be.Records) != 2 {
+		t.Fatalf("got %v, want batch error of 2 records", err)
+	}
+	if sink.Check() == nil {
+		t.Error("check passed after failed batch")
+	}
+}
+
+func TestHECHeaders(t *testing.T) {
+	h := newHECStandIn(t)
+	sink, err := NewHECSink(HECOptions{URL: h.server.URL + hecEventPath, Token: "tok"}, testFormat("msg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Send(&Record{Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.headers[0].Get("Authorization"); got != "Splunk tok" {
+		t.Errorf("authorization: got %q, want %q", got, "Splunk tok")
+	}
+	if got := h.headers[0].Get("Content-Type"); got != "application/json" {
+		t.Errorf("content type: got %q", got)
+	}
+	if got := h.headers[0].Get(hecChannelHeader); got != "" {
+		t.Errorf("channel without ack: got %q", got)
+	}
+	if err = sink.Check(); err != nil {
+		t.Errorf("check after delivery: %v", err)
+	}
+}
+
+func TestHECEvent(t *testing.T) {
+	h := newHECStandIn(t)
+	opts := HECOptions{URL: h.server.URL, Token: "tok", Index: "idx", Sourcetype: "st", Source: "src", Host: "hst"}
+	stamp := time.UnixMilli(1690000000500)
+
+	tests := []struct {
+		name   string
+		format Formatter
+		rec    *Record
+		time   float64
+		event  interface{}
+	}{
+		{"record time", testFormat("CEF:0|a"), &Record{Time: stamp}, 1690000000.5, "CEF:0|a"},
+		{"event time", testFormat("CEF:0|a"), &Record{Time: stamp, Event: &api.EventRepresentation{Time: 1680000000123}},
+			1680000000.123, "CEF:0|a"},
+		{"json", testFormat(`{"a":1}`), &Record{Time: stamp}, 1690000000.5, map[string]interface{}{"a": float64(1)}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink, err := NewHECSink(opts, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = sink.Send(tt.rec); err != nil {
+				t.Fatal(err)
+			}
+			ev := h.requests()[i][0]
+			if ev["time"] != tt.time {
+				t.Errorf("time: got %v, want %v", ev["time"], tt.time)
+			}
+			if fmt.Sprint(ev["event"]) != fmt.Sprint(tt.event) {
+				t.Errorf("event: got %v, want %v", ev["event"], tt.event)
+			}
+			for key, want := range map[string]string{"index": "idx", "sourcetype": "st", "source": "src", "host": "hst"} {
+				if ev[key] != want {
+					t.Errorf("%s: got %v, want %s", key, ev[key], want)
+				}
+			}
+		})
+	}
+}
+
+func TestHECAck(t *testing.T) {
+	h := newHECStandIn(t)
+	h.ackPoll = 2
+	sink, err := NewHECSink(HECOptions{
+		URL:         h.server.URL,
+		Token:       "tok",
+		Ack:         true,
+		AckInterval: time.Millisecond,
+	}, testFormat("msg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Send(&Record{Time: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if h.polls != 3 {
+		t.Errorf("ack polls: got %d, want 3", h.polls)
+	}
+	if h.headers[0].Get(hecChannelHeader) == "" {
+		t.Error("channel header missing")
+	}
+}
+
+func TestHECAckTimeout(t *testing.T) {
+	h := newHECStandIn(t)
+	h.ackPoll = -1
+	sink, err := NewHECSink(HECOptions{
+		URL:         h.server.URL,
+		Ack:         true,
+		AckTimeout:  10 * time.Millisecond,
+		AckInterval: time.Millisecond,
+	}, testFormat("msg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Send(&Record{Time: time.Now()}); !errors.Is(err, ErrHECAckTimeout) {
+		t.Fatalf("got %v, want %v", err, ErrHECAckTimeout)
+	}
+}
+
+func TestHECAckCanceled(t *testing.T) {
+	h := newHECStandIn(t)
+	h.ackPoll = -1
+	ctx, cancel := context.WithCancel(context.Background())
+	sink, err := NewHECSink(HECOptions{
+		URL:         h.server.URL,
+		Ack:         true,
+		AckInterval: time.Hour,
+		Context:     ctx,
+	}, testFormat("msg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	if err = sink.Send(&Record{Time: time.Now()}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want %v", err, context.Canceled)
+	}
+	if time.Since(start) > time.Second || h.polls != 1 {
+		t.Errorf("got %d poll(s) after %s, want a last poll once canceled", h.polls, time.Since(start))
+	}
+}
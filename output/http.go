@@ -0,0 +1,126 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+// HTTP requests with retries, shared by HTTP based sinks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTP defaults
+const (
+	HTTPTimeoutDefault   = 10 * time.Second
+	HTTPRetryWaitDefault = time.Second
+	httpErrorBodyMax     = 512
+)
+
+// HTTPStatusError is returned for responses without success status
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error match interface
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// temporary returns true if request may succeed if retried
+func (e *HTTPStatusError) temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// httpRetry sends requests and retries on network errors, 429 and 5xx responses with doubling wait
+type httpRetry struct {
+	client  *http.Client
+	retries int
+	wait    time.Duration
+	ctx     context.Context // waits give up once done
+}
+
+// newHTTPRetry returns httpRetry. Defaults are used for zero timeout and wait, background context for nil ctx
+func newHTTPRetry(ctx context.Context, timeout time.Duration, retries int, wait time.Duration) *httpRetry {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout <= 0 {
+		timeout = HTTPTimeoutDefault
+	}
+	if wait <= 0 {
+		wait = HTTPRetryWaitDefault
+	}
+	return &httpRetry{client: &http.Client{Timeout: timeout}, retries: retries, wait: wait, ctx: ctx}
+}
+
+// do sends request returned by build until it succeeds or retries are exhausted and returns response body. Waiting
+// for a retry gives up with error of last attempt once context is done
+func (h *httpRetry) do(build func() (*http.Request, error)) ([]byte, error) {
+	wait := h.wait
+	for attempt := 0; ; attempt++ {
+		body, retry, err := h.try(build)
+		if err == nil || !retry || attempt >= h.retries {
+			return body, err
+		}
+		if h.sleep(wait) != nil {
+			return body, err
+		}
+		wait *= 2
+	}
+}
+
+// sleep waits for d and returns context error if context is done before
+func (h *httpRetry) sleep(d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-h.ctx.Done():
+		return h.ctx.Err()
+	}
+}
+
+// try sends request once and returns response body, whether a retry makes sense and error
+func (h *httpRetry) try(build func() (*http.Request, error)) ([]byte, bool, error) {
+	req, err := build()
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		msg := strings.TrimSpace(string(body))
+		if len(msg) > httpErrorBodyMax {
+			msg = msg[:httpErrorBodyMax]
+		}
+		e := &HTTPStatusError{StatusCode: resp.StatusCode, Body: msg}
+		return body, e.temporary(), e
+	}
+	return body, false, nil
+}
@@ -0,0 +1,181 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+// Native journald protocol, see https://systemd.io/JOURNAL_NATIVE_PROTOCOL/
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// JournaldSocket is the default path of the journald native socket
+const JournaldSocket = "/run/systemd/journal/socket"
+
+// journaldFieldInvalid matches characters not allowed in journal field names
+var journaldFieldInvalid = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// JournaldSink sends records with structured fields to journald
+type JournaldSink struct {
+	path     string
+	tag      string
+	facility cefsyslog.Priority
+	format   Formatter
+	mu       sync.Mutex // guards conn
+	conn     net.Conn
+}
+
+// NewJournaldSink returns Sink connected to journald socket at path. JournaldSocket is used if path is empty
+func NewJournaldSink(path, tag string, facility cefsyslog.Priority, format Formatter) (*JournaldSink, error) {
+	if path == "" {
+		path = JournaldSocket
+	}
+	s := &JournaldSink{path: path, tag: tag, facility: facility, format: format}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Send match interface
+func (s *JournaldSink) Send(rec *Record) error {
+	msg, err := s.format.Format(rec)
+	if err != nil {
+		return err
+	}
+	bs := s.message(rec, msg)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		if _, err = s.conn.Write(bs); err == nil {
+			return nil
+		}
+	}
+	if err = s.connect(); err != nil {
+		return err
+	}
+	_, err = s.conn.Write(bs)
+	return err
+}
+
+// Close match interface
+func (s *JournaldSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil {
+		err := s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Check match interface
+func (s *JournaldSink) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return errors.New("not connected")
+	}
+	return nil
+}
+
+// message returns journal entry with formatted message and fields from record header, event attributes and details
+func (s *JournaldSink) message(rec *Record, msg string) []byte {
+	fields := map[string]string{
+		"PRIORITY":          fmt.Sprintf("%d", rec.LogLevel),
+		"SYSLOG_IDENTIFIER": s.tag,
+		"SYSLOG_FACILITY":   fmt.Sprintf("%d", s.facility>>3),
+		"LOGSYNC_CLASS_ID":  rec.CEF.EventClassID,
+		"LOGSYNC_NAME":      rec.CEF.Name,
+		"LOGSYNC_SEVERITY":  fmt.Sprintf("%d", rec.CEF.Severity),
+	}
+	if er := rec.Event; er != nil {
+		for key, value := range map[string]*string{
+			"LOGSYNC_EVENT_TYPE": er.Type,
+			"LOGSYNC_REALM_ID":   er.RealmID,
+			"LOGSYNC_CLIENT_ID":  er.ClientID,
+			"LOGSYNC_USER_ID":    er.UserID,
+			"LOGSYNC_SESSION_ID": er.SessionID,
+			"LOGSYNC_IP_ADDRESS": er.IPAddress,
+		} {
+			if value != nil {
+				fields[key] = *value
+			}
+		}
+		for key, value := range er.Details {
+			fields["LOGSYNC_DETAIL_"+journaldFieldInvalid.ReplaceAllString(strings.ToUpper(key), "_")] = value
+		}
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	writeJournaldField(&buf, "MESSAGE", msg)
+	for _, key := range keys {
+		writeJournaldField(&buf, key, fields[key])
+	}
+	return buf.Bytes()
+}
+
+// connect makes a connection to the journald socket. It must be called with s.mu held.
+func (s *JournaldSink) connect() error {
+	if s.conn != nil {
+		// ignore err from close, it makes sense to continue anyway
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+	c, err := net.Dial("unixgram", s.path)
+	if err != nil {
+		return err
+	}
+	s.conn = c
+	return nil
+}
+
+// writeJournaldField appends field as KEY=value line. Values containing newlines are written length prefixed
+func writeJournaldField(buf *bytes.Buffer, key, value string) {
+	buf.WriteString(key)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	_ = binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
@@ -0,0 +1,198 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"strings"
+	"time"
+)
+
+// JSON formatter configuration keys and values
+const (
+	jsonConfigSchema = "schema"
+	jsonSchemaPlain  = "plain"
+	jsonSchemaECS    = "ecs"
+	ecsVersion       = "8.11.0"
+)
+
+// syslogSeverityNames as used by log.syslog.severity.name
+var syslogSeverityNames = []string{
+	"emergency", "alert", "critical", "error", "warning", "notice", "informational", "debug",
+}
+
+// JSONFormatter renders records as single line JSON documents, optionally following Elastic Common Schema
+type JSONFormatter struct {
+	schema string
+}
+
+// jsonRecord is the plain JSON representation of a record
+type jsonRecord struct {
+	Timestamp string                   `json:"timestamp"`
+	Vendor    string                   `json:"vendor"`
+	Product   string                   `json:"product"`
+	Version   string                   `json:"version"`
+	ClassID   string                   `json:"class_id"`
+	Name      string                   `json:"name"`
+	Severity  cefsyslog.Priority       `json:"severity"`
+	LogLevel  cefsyslog.Priority       `json:"loglevel"`
+	Extension cefsyslog.Extensions     `json:"extension,omitempty"`
+	Event     *api.EventRepresentation `json:"event,omitempty"`
+}
+
+// ecsRecord is the Elastic Common Schema representation of a record
+type ecsRecord struct {
+	Timestamp string `json:"@timestamp"`
+	Message   string `json:"message"`
+	ECS       struct {
+		Version string `json:"version"`
+	} `json:"ecs"`
+	Event struct {
+		Action   string             `json:"action,omitempty"`
+		Code     string             `json:"code"`
+		Kind     string             `json:"kind"`
+		Outcome  string             `json:"outcome,omitempty"`
+		Severity cefsyslog.Priority `json:"severity"`
+		Created  string             `json:"created"`
+	} `json:"event"`
+	Log struct {
+		Level  string `json:"level"`
+		Syslog struct {
+			Severity struct {
+				Code cefsyslog.Priority `json:"code"`
+				Name string             `json:"name"`
+			} `json:"severity"`
+		} `json:"syslog"`
+	} `json:"log"`
+	Observer struct {
+		Vendor  string `json:"vendor"`
+		Product string `json:"product"`
+		Version string `json:"version"`
+	} `json:"observer"`
+	Source *ecsSource        `json:"source,omitempty"`
+	User   *ecsUser          `json:"user,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type ecsSource struct {
+	IP string `json:"ip"`
+}
+
+type ecsUser struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// NewJSONFormatter returns Formatter
+func NewJSONFormatter(cfg map[string]string) (*JSONFormatter, error) {
+	f := &JSONFormatter{schema: cfg[jsonConfigSchema]}
+	switch f.schema {
+	case "":
+		f.schema = jsonSchemaPlain
+	case jsonSchemaPlain, jsonSchemaECS:
+	default:
+		return nil, fmt.Errorf("unsupported json schema: %s", f.schema)
+	}
+	return f, nil
+}
+
+// Format match interface
+func (f *JSONFormatter) Format(rec *Record) (string, error) {
+	var v interface{}
+	if f.schema == jsonSchemaECS {
+		v = f.ecs(rec)
+	} else {
+		v = f.plain(rec)
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// plain returns JSON representation using CEF header names
+func (f *JSONFormatter) plain(rec *Record) *jsonRecord {
+	return &jsonRecord{
+		Timestamp: rec.Time.UTC().Format(time.RFC3339Nano),
+		Vendor:    rec.CEF.DeviceVendor,
+		Product:   rec.CEF.DeviceProduct,
+		Version:   rec.CEF.DeviceVersion,
+		ClassID:   rec.CEF.EventClassID,
+		Name:      rec.CEF.Name,
+		Severity:  rec.CEF.Severity,
+		LogLevel:  rec.LogLevel,
+		Extension: rec.CEF.Extension,
+		Event:     rec.Event,
+	}
+}
+
+// ecs returns Elastic Common Schema representation
+func (f *JSONFormatter) ecs(rec *Record) *ecsRecord {
+	r := new(ecsRecord)
+	r.Timestamp = rec.Time.UTC().Format(time.RFC3339Nano)
+	r.Message = rec.CEF.Name
+	r.ECS.Version = ecsVersion
+	r.Event.Code = rec.CEF.EventClassID
+	r.Event.Kind = "event"
+	r.Event.Severity = rec.CEF.Severity
+	r.Event.Created = time.Now().UTC().Format(time.RFC3339Nano)
+	r.Log.Syslog.Severity.Code = rec.LogLevel
+	if rec.LogLevel >= 0 && int(rec.LogLevel) < len(syslogSeverityNames) {
+		r.Log.Syslog.Severity.Name = syslogSeverityNames[rec.LogLevel]
+		r.Log.Level = r.Log.Syslog.Severity.Name
+	}
+	r.Observer.Vendor = rec.CEF.DeviceVendor
+	r.Observer.Product = rec.CEF.DeviceProduct
+	r.Observer.Version = rec.CEF.DeviceVersion
+
+	er := rec.Event
+	if er == nil {
+		return r
+	}
+	if er.Type != nil {
+		r.Event.Action = *er.Type
+		r.Event.Outcome = "success"
+		if strings.HasSuffix(*er.Type, "_ERROR") {
+			r.Event.Outcome = "failure"
+		}
+	}
+	if er.IPAddress != nil {
+		r.Source = &ecsSource{IP: *er.IPAddress}
+	}
+	if er.UserID != nil || er.HasDetail("username") {
+		r.User = &ecsUser{Name: er.GetDetail("username", "")}
+		if er.UserID != nil {
+			r.User.ID = *er.UserID
+		}
+	}
+	r.Labels = map[string]string{}
+	for key, value := range map[string]*string{
+		"realm_id":   er.RealmID,
+		"client_id":  er.ClientID,
+		"session_id": er.SessionID,
+	} {
+		if value != nil {
+			r.Labels[key] = *value
+		}
+	}
+	if source := rec.CEF.Extension[cefsyslog.ExtDeviceExtID]; source != "" {
+		r.Labels["source"] = source
+	}
+	return r
+}
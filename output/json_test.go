@@ -0,0 +1,151 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"encoding/json"
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRecord returns record of event type with all identifying fields set
+func testRecord(eventType string) *Record {
+	str := func(s string) *string { return &s }
+	cef := cefsyslog.NewCEF(eventType, "Event "+eventType, cefsyslog.LOG_WARNING)
+	cef.Extension[cefsyslog.ExtSourceUserName] = "jdoe"
+	cef.Extension[cefsyslog.ExtDeviceExtID] = "lms"
+	return &Record{
+		Time:     time.Date(2023, 5, 4, 13, 2, 3, 45e6, time.UTC),
+		LogLevel: cefsyslog.LOG_NOTICE,
+		CEF:      cef,
+		Event: &api.EventRepresentation{
+			Time:      1683205323045,
+			Type:      str(eventType),
+			RealmID:   str("realm"),
+			ClientID:  str("client"),
+			UserID:    str("uid"),
+			SessionID: str("sid"),
+			IPAddress: str("10.0.0.1"),
+			Details:   map[string]string{"username": "jdoe"},
+		},
+	}
+}
+
+// normalized returns JSON document with keys sorted and given keys (up to one level nested) removed. Removed keys
+// must be set
+func normalized(t *testing.T, doc string, remove ...string) string {
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(doc), &m); err != nil {
+		t.Fatalf("%v: %s", err, doc)
+	}
+	for _, path := range remove {
+		parent, key := m, path
+		if p, k, ok := strings.Cut(path, "."); ok {
+			parent, _ = m[p].(map[string]interface{})
+			key = k
+		}
+		if _, ok := parent[key]; !ok {
+			t.Errorf("%s missing in %s", path, doc)
+		}
+		delete(parent, key)
+	}
+	bs, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bs)
+}
+
+func TestJSONFormatPlain(t *testing.T) {
+	f, err := NewFormatter(FormatJSON, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := f.Format(testRecord("LOGIN"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"timestamp":"2023-05-04T13:02:03.045Z","vendor":"Swiss Learning Hub AG","product":"LMS","version":"1.0.0",` +
+		`"class_id":"LOGIN","name":"Event LOGIN","severity":4,"loglevel":5,` +
+		`"extension":{"deviceExternalId":"lms","suser":"jdoe"},` +
+		`"event":{"time":1683205323045,"type":"LOGIN","realmId":"realm","clientId":"client","userId":"uid",` +
+		`"sessionId":"sid","ipAddress":"10.0.0.1","details":{"username":"jdoe"}}}`
+	if got != want {
+		t.Errorf("\ngot  %s\nwant %s", got, want)
+	}
+}
+
+func TestJSONFormatECS(t *testing.T) {
+	f, err := NewFormatter(FormatJSON, map[string]string{"schema": "ecs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		rec  *Record
+		want string
+	}{
+		{
+			name: "success",
+			rec:  testRecord("LOGIN"),
+			want: `{"@timestamp":"2023-05-04T13:02:03.045Z","ecs":{"version":"8.11.0"},` +
+				`"event":{"action":"LOGIN","code":"LOGIN","kind":"event","outcome":"success","severity":4},` +
+				`"labels":{"client_id":"client","realm_id":"realm","session_id":"sid","source":"lms"},` +
+				`"log":{"level":"notice","syslog":{"severity":{"code":5,"name":"notice"}}},"message":"Event LOGIN",` +
+				`"observer":{"product":"LMS","vendor":"Swiss Learning Hub AG","version":"1.0.0"},` +
+				`"source":{"ip":"10.0.0.1"},"user":{"id":"uid","name":"jdoe"}}`,
+		},
+		{
+			name: "failure",
+			rec:  testRecord("LOGIN_ERROR"),
+			want: `{"@timestamp":"2023-05-04T13:02:03.045Z","ecs":{"version":"8.11.0"},` +
+				`"event":{"action":"LOGIN_ERROR","code":"LOGIN_ERROR","kind":"event","outcome":"failure","severity":4},` +
+				`"labels":{"client_id":"client","realm_id":"realm","session_id":"sid","source":"lms"},` +
+				`"log":{"level":"notice","syslog":{"severity":{"code":5,"name":"notice"}}},"message":"Event LOGIN_ERROR",` +
+				`"observer":{"product":"LMS","vendor":"Swiss Learning Hub AG","version":"1.0.0"},` +
+				`"source":{"ip":"10.0.0.1"},"user":{"id":"uid","name":"jdoe"}}`,
+		},
+		{
+			name: "without event",
+			rec: &Record{
+				Time:     time.Date(2023, 5, 4, 13, 2, 3, 0, time.UTC),
+				LogLevel: cefsyslog.Priority(9),
+				CEF:      cefsyslog.NewCEF("X", "x", 1),
+			},
+			want: `{"@timestamp":"2023-05-04T13:02:03Z","ecs":{"version":"8.11.0"},` +
+				`"event":{"code":"X","kind":"event","severity":1},` +
+				`"log":{"level":"","syslog":{"severity":{"code":9,"name":""}}},"message":"x",` +
+				`"observer":{"product":"LMS","vendor":"Swiss Learning Hub AG","version":"1.0.0"}}`,
+		},
+	}
+	for _, tt := range tests {
+		doc, err := f.Format(tt.rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := normalized(t, doc, "event.created"); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestJSONFormatterInvalid(t *testing.T) {
+	if _, err := NewJSONFormatter(map[string]string{"schema": "ocsf"}); err == nil {
+		t.Error("got no error for unknown schema")
+	}
+}
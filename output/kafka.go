@@ -0,0 +1,275 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"os"
+	"time"
+)
+
+// Kafka message key selection
+const (
+	KafkaKeyNone      = ""
+	KafkaKeyUserID    = "userId"
+	KafkaKeyRealmID   = "realmId"
+	KafkaKeyClientID  = "clientId"
+	KafkaKeySessionID = "sessionId"
+	KafkaKeyIPAddress = "ipAddress"
+	KafkaKeyClassID   = "classId"
+)
+
+// Kafka SASL mechanisms
+const (
+	KafkaSASLPlain       = "plain"
+	KafkaSASLScramSHA256 = "scram-sha-256"
+	KafkaSASLScramSHA512 = "scram-sha-512"
+)
+
+// Kafka acks
+const (
+	KafkaAcksNone   = "none"
+	KafkaAcksLeader = "leader"
+	KafkaAcksAll    = "all"
+)
+
+// Kafka defaults
+const (
+	KafkaBatchSizeDefault = 100
+	KafkaTimeoutDefault   = 10 * time.Second
+	kafkaBatchTimeout     = 10 * time.Millisecond
+	kafkaHeaderClassID    = "class_id"
+)
+
+var kafkaCompression = map[string]kafka.Compression{
+	"gzip":   kafka.Gzip,
+	"snappy": kafka.Snappy,
+	"lz4":    kafka.Lz4,
+	"zstd":   kafka.Zstd,
+}
+
+var kafkaAcks = map[string]kafka.RequiredAcks{
+	KafkaAcksNone:   kafka.RequireNone,
+	KafkaAcksLeader: kafka.RequireOne,
+	KafkaAcksAll:    kafka.RequireAll,
+}
+
+// KafkaOptions configure a KafkaSink
+type KafkaOptions struct {
+	Brokers       []string
+	Topic         string
+	Key           string // event attribute used as message key, round-robin over partitions if empty
+	Compression   string // none (default), gzip, snappy, lz4 or zstd
+	Acks          string // none, leader or all (default)
+	BatchSize     int
+	Timeout       time.Duration
+	SASLMechanism string
+	SASLUsername  string
+	SASLPassword  string
+	TLS           bool
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSInsecure   bool
+}
+
+// KafkaSink produces records as messages to a Kafka topic
+type KafkaSink struct {
+	writer  *kafka.Writer
+	format  Formatter
+	key     string
+	timeout time.Duration
+	batch   *batch
+	delivery
+}
+
+// NewKafkaSink returns Sink. Records are collected and produced in batches
+func NewKafkaSink(opts KafkaOptions, format Formatter) (*KafkaSink, error) {
+	if len(opts.Brokers) == 0 {
+		return nil, errors.New("no kafka broker")
+	}
+	switch opts.Key {
+	case KafkaKeyNone, KafkaKeyUserID, KafkaKeyRealmID, KafkaKeyClientID, KafkaKeySessionID, KafkaKeyIPAddress,
+		KafkaKeyClassID:
+	default:
+		return nil, fmt.Errorf("unknown kafka key: %s", opts.Key)
+	}
+	if opts.Acks == "" {
+		opts.Acks = KafkaAcksAll
+	}
+	acks, ok := kafkaAcks[opts.Acks]
+	if !ok {
+		return nil, fmt.Errorf("unknown kafka acks: %s", opts.Acks)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = KafkaBatchSizeDefault
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = KafkaTimeoutDefault
+	}
+
+	transport := &kafka.Transport{DialTimeout: opts.Timeout}
+	var err error
+	if transport.SASL, err = kafkaSASL(opts); err != nil {
+		return nil, err
+	}
+	if transport.TLS, err = kafkaTLS(opts); err != nil {
+		return nil, err
+	}
+
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(opts.Brokers...),
+		Topic:        opts.Topic,
+		Balancer:     &kafka.RoundRobin{},
+		RequiredAcks: acks,
+		BatchSize:    opts.BatchSize,
+		BatchTimeout: kafkaBatchTimeout,
+		WriteTimeout: opts.Timeout,
+		Transport:    transport,
+	}
+	if opts.Key != KafkaKeyNone {
+		w.Balancer = &kafka.Hash{}
+	}
+	switch opts.Compression {
+	case "", "none":
+	default:
+		c, ok := kafkaCompression[opts.Compression]
+		if !ok {
+			return nil, fmt.Errorf("unknown kafka compression: %s", opts.Compression)
+		}
+		w.Compression = c
+	}
+
+	s := &KafkaSink{writer: w, format: format, key: opts.Key, timeout: opts.Timeout}
+	s.batch = &batch{size: opts.BatchSize, send: s.produce}
+	return s, nil
+}
+
+// Send match interface
+func (s *KafkaSink) Send(rec *Record) error {
+	return s.batch.add(rec)
+}
+
+// Flush match interface
+func (s *KafkaSink) Flush() error {
+	return s.batch.Flush()
+}
+
+// Close match interface. Remaining records are produced
+func (s *KafkaSink) Close() error {
+	err := s.batch.Flush()
+	if errClose := s.writer.Close(); err == nil {
+		err = errClose
+	}
+	return err
+}
+
+// produce writes records as messages and waits for acknowledgement as configured
+func (s *KafkaSink) produce(recs []*Record) error {
+	msgs := make([]kafka.Message, 0, len(recs))
+	for _, rec := range recs {
+		value, err := s.format.Format(rec)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, kafka.Message{
+			Key:     s.messageKey(rec),
+			Value:   []byte(value),
+			Time:    rec.Time,
+			Headers: []kafka.Header{{Key: kafkaHeaderClassID, Value: []byte(rec.CEF.EventClassID)}},
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout*time.Duration(len(msgs)/s.writer.BatchSize+1))
+	defer cancel()
+	return s.done(s.writer.WriteMessages(ctx, msgs...))
+}
+
+// messageKey returns configured event attribute as message key, nil if not set
+func (s *KafkaSink) messageKey(rec *Record) []byte {
+	if s.key == KafkaKeyClassID {
+		return []byte(rec.CEF.EventClassID)
+	}
+	er := rec.Event
+	if er == nil {
+		return nil
+	}
+	var v *string
+	switch s.key {
+	case KafkaKeyUserID:
+		v = er.UserID
+	case KafkaKeyRealmID:
+		v = er.RealmID
+	case KafkaKeyClientID:
+		v = er.ClientID
+	case KafkaKeySessionID:
+		v = er.SessionID
+	case KafkaKeyIPAddress:
+		v = er.IPAddress
+	}
+	if v == nil {
+		return nil
+	}
+	return []byte(*v)
+}
+
+// kafkaSASL returns configured SASL mechanism, nil if none
+func kafkaSASL(opts KafkaOptions) (sasl.Mechanism, error) {
+	switch opts.SASLMechanism {
+	case "":
+		return nil, nil
+	case KafkaSASLPlain:
+		return plain.Mechanism{Username: opts.SASLUsername, Password: opts.SASLPassword}, nil
+	case KafkaSASLScramSHA256:
+		return scram.Mechanism(scram.SHA256, opts.SASLUsername, opts.SASLPassword)
+	case KafkaSASLScramSHA512:
+		return scram.Mechanism(scram.SHA512, opts.SASLUsername, opts.SASLPassword)
+	default:
+		return nil, fmt.Errorf("unknown kafka sasl mechanism: %s", opts.SASLMechanism)
+	}
+}
+
+// kafkaTLS returns TLS configuration, nil if TLS is disabled
+func kafkaTLS(opts KafkaOptions) (*tls.Config, error) {
+	if !opts.TLS {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: opts.TLSInsecure}
+	if opts.TLSCAFile != "" {
+		pem, err := os.ReadFile(opts.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate in %s", opts.TLSCAFile)
+		}
+	}
+	if opts.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.TLSCertFile, opts.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
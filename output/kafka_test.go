@@ -0,0 +1,277 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/protocol"
+	metadataAPI "github.com/segmentio/kafka-go/protocol/metadata"
+	produceAPI "github.com/segmentio/kafka-go/protocol/produce"
+	"github.com/swisslearninghub/logsync/api"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	kafkaTestTopic      = "events"
+	kafkaTestPartitions = 3
+)
+
+// kafkaMessage is a message received by kafkaStandIn
+type kafkaMessage struct {
+	partition int32
+	key       string
+	value     string
+	classID   string
+}
+
+// kafkaStandIn is an in-process broker answering metadata and produce requests of the writer
+type kafkaStandIn struct {
+	mu          sync.Mutex
+	acks        []int16
+	compression []kafka.Compression
+	messages    []kafkaMessage
+	err         error // returned for produce requests if set
+}
+
+// RoundTrip match kafka.RoundTripper
+func (k *kafkaStandIn) RoundTrip(_ context.Context, addr net.Addr, req protocol.Message) (protocol.Message, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	switch r := req.(type) {
+	case *metadataAPI.Request:
+		res := &metadataAPI.Response{
+			Brokers: []metadataAPI.ResponseBroker{{NodeID: 1, Host: "localhost", Port: 9092}},
+			Topics:  []metadataAPI.ResponseTopic{{Name: kafkaTestTopic}},
+		}
+		for i := int32(0); i < kafkaTestPartitions; i++ {
+			res.Topics[0].Partitions = append(res.Topics[0].Partitions,
+				metadataAPI.ResponsePartition{PartitionIndex: i, LeaderID: 1})
+		}
+		return res, nil
+	case *produceAPI.Request:
+		if k.err != nil {
+			return nil, k.err
+		}
+		k.acks = append(k.acks, r.Acks)
+		res := &produceAPI.Response{}
+		for _, t := range r.Topics {
+			rt := produceAPI.ResponseTopic{Topic: t.Topic}
+			for _, p := range t.Partitions {
+				k.compression = append(k.compression, p.RecordSet.Attributes.Compression())
+				if err := k.read(p.Partition, p.RecordSet.Records); err != nil {
+					return nil, err
+				}
+				rt.Partitions = append(rt.Partitions, produceAPI.ResponsePartition{Partition: p.Partition})
+			}
+			res.Topics = append(res.Topics, rt)
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("unexpected request %T to %s", req, addr)
+	}
+}
+
+// read records messages of partition
+func (k *kafkaStandIn) read(partition int32, records protocol.RecordReader) error {
+	for {
+		rec, err := records.ReadRecord()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		key, err := protocol.ReadAll(rec.Key)
+		if err != nil {
+			return err
+		}
+		value, err := protocol.ReadAll(rec.Value)
+		if err != nil {
+			return err
+		}
+		msg := kafkaMessage{partition: partition, key: string(key), value: string(value)}
+		for _, h := range rec.Headers {
+			if h.Key == kafkaHeaderClassID {
+				msg.classID = string(h.Value)
+			}
+		}
+		k.messages = append(k.messages, msg)
+	}
+}
+
+// newKafkaTestSink returns sink producing to stand-in
+func newKafkaTestSink(t *testing.T, opts KafkaOptions) (*KafkaSink, *kafkaStandIn) {
+	opts.Brokers = []string{"localhost:9092"}
+	opts.Topic = kafkaTestTopic
+	sink, err := NewKafkaSink(opts, testFormat("msg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := new(kafkaStandIn)
+	sink.writer.Transport = k
+	t.Cleanup(func() { _ = sink.Close() })
+	return sink, k
+}
+
+// kafkaRecord returns record of an event by given user of detection classID
+func kafkaRecord(classID, userID string) *Record {
+	return &Record{
+		Time:  time.Now(),
+		CEF:   &cefsyslog.CEF{EventClassID: classID},
+		Event: &api.EventRepresentation{UserID: &userID},
+	}
+}
+
+func TestKafkaKey(t *testing.T) {
+	realm, client, session, ip, user := "realm", "client", "session", "10.0.0.1", "user"
+	rec := &Record{
+		CEF: &cefsyslog.CEF{EventClassID: "42"},
+		Event: &api.EventRepresentation{
+			RealmID:   &realm,
+			ClientID:  &client,
+			SessionID: &session,
+			IPAddress: &ip,
+			UserID:    &user,
+		},
+	}
+	tests := []struct {
+		key  string
+		rec  *Record
+		want []byte
+	}{
+		{KafkaKeyNone, rec, nil},
+		{KafkaKeyUserID, rec, []byte(user)},
+		{KafkaKeyRealmID, rec, []byte(realm)},
+		{KafkaKeyClientID, rec, []byte(client)},
+		{KafkaKeySessionID, rec, []byte(session)},
+		{KafkaKeyIPAddress, rec, []byte(ip)},
+		{KafkaKeyClassID, rec, []byte("42")},
+		{KafkaKeyUserID, &Record{CEF: rec.CEF, Event: &api.EventRepresentation{}}, nil},
+		{KafkaKeyUserID, &Record{CEF: rec.CEF}, nil},
+	}
+	for _, tt := range tests {
+		s := &KafkaSink{key: tt.key}
+		if got := s.messageKey(tt.rec); string(got) != string(tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("key %q: got %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestKafkaProduceKey(t *testing.T) {
+	sink, k := newKafkaTestSink(t, KafkaOptions{Key: KafkaKeyUserID, BatchSize: 10})
+	users := []string{"a", "b", "c", "a", "b", "c"}
+	for _, user := range users {
+		if err := sink.Send(kafkaRecord("7", user)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(k.messages) != len(users) {
+		t.Fatalf("messages: got %d, want %d", len(k.messages), len(users))
+	}
+	partitions := map[string]int32{}
+	for _, msg := range k.messages {
+		if msg.value != "msg" || msg.classID != "7" {
+			t.Errorf("message: got %+v", msg)
+		}
+		if p, ok := partitions[msg.key]; ok && p != msg.partition {
+			t.Errorf("key %s: produced to partitions %d and %d", msg.key, p, msg.partition)
+		}
+		partitions[msg.key] = msg.partition
+	}
+}
+
+func TestKafkaAcks(t *testing.T) {
+	tests := []struct {
+		acks string
+		want int16
+	}{
+		{"", int16(kafka.RequireAll)},
+		{KafkaAcksAll, int16(kafka.RequireAll)},
+		{KafkaAcksLeader, int16(kafka.RequireOne)},
+		{KafkaAcksNone, int16(kafka.RequireNone)},
+	}
+	for _, tt := range tests {
+		sink, k := newKafkaTestSink(t, KafkaOptions{Acks: tt.acks})
+		if err := sink.Send(kafkaRecord("1", "u")); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Flush(); err != nil {
+			t.Fatalf("acks %q: %v", tt.acks, err)
+		}
+		if len(k.acks) != 1 || k.acks[0] != tt.want {
+			t.Errorf("acks %q: got %v, want %d", tt.acks, k.acks, tt.want)
+		}
+	}
+	if _, err := NewKafkaSink(KafkaOptions{Brokers: []string{"localhost:9092"}, Acks: "some"}, testFormat("")); err == nil {
+		t.Error("unknown acks accepted")
+	}
+}
+
+func TestKafkaCompression(t *testing.T) {
+	tests := []struct {
+		compression string
+		want        kafka.Compression
+	}{
+		{"", 0},
+		{"none", 0},
+		{"gzip", kafka.Gzip},
+		{"snappy", kafka.Snappy},
+		{"lz4", kafka.Lz4},
+		{"zstd", kafka.Zstd},
+	}
+	for _, tt := range tests {
+		sink, k := newKafkaTestSink(t, KafkaOptions{Compression: tt.compression})
+		if err := sink.Send(kafkaRecord("1", "u")); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Flush(); err != nil {
+			t.Fatalf("compression %q: %v", tt.compression, err)
+		}
+		if len(k.compression) != 1 || k.compression[0] != tt.want {
+			t.Errorf("compression %q: got %v, want %v", tt.compression, k.compression, tt.want)
+		}
+	}
+	if _, err := NewKafkaSink(KafkaOptions{Brokers: []string{"localhost:9092"}, Compression: "lzma"}, testFormat("")); err == nil {
+		t.Error("unknown compression accepted")
+	}
+}
+
+func TestKafkaBatchError(t *testing.T) {
+	sink, k := newKafkaTestSink(t, KafkaOptions{BatchSize: 2, Timeout: 100 * time.Millisecond})
+	k.err = errors.New("broker down")
+	if err := sink.Send(kafkaRecord("1", "u")); err != nil {
+		t.Fatal(err)
+	}
+	err := sink.Send(kafkaRecord("1", "u"))
+	var be *BatchError
+	if !errors.As(err, &be) || len(be.Records) != 2 {
+		t.Fatalf("got %v, want batch error of 2 records", err)
+	}
+	if sink.Check() == nil {
+		t.Error("check passed after failed batch")
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"fmt"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+)
+
+// LEEF formatter configuration keys
+const (
+	leefConfigVersion       = "version"
+	leefConfigDelimiter     = "delimiter"
+	leefConfigDevTimeFormat = "devtime_format"
+)
+
+// LEEFFormatter renders records as LEEF 1.0 or 2.0
+type LEEFFormatter struct {
+	version       string
+	delimiter     rune
+	devTimeFormat string
+}
+
+// NewLEEFFormatter returns Formatter
+func NewLEEFFormatter(cfg map[string]string) (*LEEFFormatter, error) {
+	var err error
+	f := &LEEFFormatter{
+		version:       cfg[leefConfigVersion],
+		devTimeFormat: cfg[leefConfigDevTimeFormat],
+	}
+	switch f.version {
+	case "":
+		f.version = cefsyslog.LEEFVersion1
+	case cefsyslog.LEEFVersion1, cefsyslog.LEEFVersion2:
+	default:
+		return nil, fmt.Errorf("unsupported leef version: %s", f.version)
+	}
+	if f.version == cefsyslog.LEEFVersion1 && cfg[leefConfigDelimiter] != "" {
+		return nil, fmt.Errorf("leef %s does not support custom delimiter", f.version)
+	}
+	if f.delimiter, err = cefsyslog.ParseLEEFDelimiter(cfg[leefConfigDelimiter]); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Format match interface
+func (f *LEEFFormatter) Format(rec *Record) (string, error) {
+	leef := cefsyslog.NewLEEFFromCEF(rec.CEF, f.version, f.delimiter)
+	leef.SetDevTime(rec.Time, f.devTimeFormat)
+	return leef.String(), nil
+}
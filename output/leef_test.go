@@ -0,0 +1,66 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"testing"
+	"time"
+)
+
+func TestLEEFFormat(t *testing.T) {
+	cef := cefsyslog.NewCEF("LOGIN", "Login", cefsyslog.LOG_NOTICE)
+	cef.Extension[cefsyslog.ExtSourceUserName] = "jdoe"
+	rec := &Record{Time: time.Date(2023, 5, 4, 13, 2, 3, 0, time.UTC), CEF: cef}
+
+	tests := []struct {
+		cfg  map[string]string
+		want string
+	}{
+		{
+			cfg:  nil,
+			want: "LEEF:1.0|Swiss Learning Hub AG|LMS|1.0.0|LOGIN|cat=Login\tdevTime=1683205323000\tsev=5\tusrName=jdoe",
+		},
+		{
+			cfg:  map[string]string{"version": "2.0", "delimiter": "x5E", "devtime_format": "yyyy-MM-dd HH:mm:ss"},
+			want: "LEEF:2.0|Swiss Learning Hub AG|LMS|1.0.0|LOGIN|^|cat=Login^devTime=2023-05-04 13:02:03^devTimeFormat=yyyy-MM-dd HH:mm:ss^sev=5^usrName=jdoe",
+		},
+	}
+	for _, tt := range tests {
+		f, err := NewFormatter(FormatLEEF, tt.cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := f.Format(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%v:\ngot  %q\nwant %q", tt.cfg, got, tt.want)
+		}
+	}
+}
+
+func TestLEEFFormatterInvalid(t *testing.T) {
+	for _, cfg := range []map[string]string{
+		{"version": "3.0"},
+		{"delimiter": "^"}, // 1.0 is tab separated
+		{"version": "2.0", "delimiter": "x00"},
+	} {
+		if _, err := NewLEEFFormatter(cfg); err == nil {
+			t.Errorf("%v: got no error", cfg)
+		}
+	}
+}
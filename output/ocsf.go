@@ -0,0 +1,207 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"encoding/json"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"strings"
+)
+
+const ocsfVersion = "1.1.0"
+
+// ocsfTypeFactor is used to calculate type_uid (class_uid * 100 + activity_id)
+const ocsfTypeFactor = 100
+
+// OCSF classes and categories
+const (
+	ocsfClassBase           = 0
+	ocsfClassAuthentication = 3002
+	ocsfCategoryOther       = 0
+	ocsfCategoryIAM         = 3
+)
+
+// OCSF activity IDs
+const (
+	ocsfActivityUnknown = 0
+	ocsfActivityLogon   = 1
+	ocsfActivityLogoff  = 2
+	ocsfActivityOther   = 99
+)
+
+// OCSF status IDs
+const (
+	ocsfStatusUnknown = 0
+	ocsfStatusSuccess = 1
+	ocsfStatusFailure = 2
+)
+
+// ocsfAuthActivities maps event types to Authentication activity and status
+var ocsfAuthActivities = map[string][2]int{
+	"LOGIN":        {ocsfActivityLogon, ocsfStatusSuccess},
+	"LOGIN_ERROR":  {ocsfActivityLogon, ocsfStatusFailure},
+	"LOGOUT":       {ocsfActivityLogoff, ocsfStatusSuccess},
+	"LOGOUT_ERROR": {ocsfActivityLogoff, ocsfStatusFailure},
+}
+
+var ocsfActivityNames = map[int]string{
+	ocsfActivityUnknown: "Unknown",
+	ocsfActivityLogon:   "Logon",
+	ocsfActivityLogoff:  "Logoff",
+	ocsfActivityOther:   "Other",
+}
+
+var ocsfStatusNames = map[int]string{
+	ocsfStatusUnknown: "Unknown",
+	ocsfStatusSuccess: "Success",
+	ocsfStatusFailure: "Failure",
+}
+
+// ocsfSeverities maps CEF severity (0-10) to OCSF severity_id
+var ocsfSeverities = []int{1, 2, 2, 2, 3, 3, 3, 4, 4, 5, 5}
+
+// OCSFFormatter renders records as OCSF events. Authentication events are mapped to class Authentication (3002),
+// all others to class Base Event (0)
+type OCSFFormatter struct{}
+
+type ocsfEvent struct {
+	Time         int64             `json:"time"`
+	Message      string            `json:"message"`
+	ClassUID     int               `json:"class_uid"`
+	ClassName    string            `json:"class_name"`
+	CategoryUID  int               `json:"category_uid"`
+	CategoryName string            `json:"category_name"`
+	ActivityID   int               `json:"activity_id"`
+	ActivityName string            `json:"activity_name"`
+	TypeUID      int               `json:"type_uid"`
+	SeverityID   int               `json:"severity_id"`
+	StatusID     int               `json:"status_id,omitempty"`
+	Status       string            `json:"status,omitempty"`
+	Metadata     ocsfMetadata      `json:"metadata"`
+	User         *ocsfUser         `json:"user,omitempty"`
+	SrcEndpoint  *ocsfEndpoint     `json:"src_endpoint,omitempty"`
+	Session      *ocsfSession      `json:"session,omitempty"`
+	Service      *ocsfService      `json:"service,omitempty"`
+	Unmapped     map[string]string `json:"unmapped,omitempty"`
+}
+
+type ocsfMetadata struct {
+	Version   string      `json:"version"`
+	EventCode string      `json:"event_code"`
+	TenantUID string      `json:"tenant_uid,omitempty"`
+	Product   ocsfProduct `json:"product"`
+}
+
+type ocsfProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+	Version    string `json:"version"`
+}
+
+type ocsfUser struct {
+	UID  string `json:"uid,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type ocsfEndpoint struct {
+	IP string `json:"ip"`
+}
+
+type ocsfSession struct {
+	UID string `json:"uid"`
+}
+
+type ocsfService struct {
+	UID string `json:"uid"`
+}
+
+// Format match interface
+func (f *OCSFFormatter) Format(rec *Record) (string, error) {
+	bs, err := json.Marshal(f.event(rec))
+	if err != nil {
+		return "", err
+	}
+	return string(bs), nil
+}
+
+// event returns OCSF representation of record
+func (f *OCSFFormatter) event(rec *Record) *ocsfEvent {
+	ev := &ocsfEvent{
+		Time:         rec.Time.UnixMilli(),
+		Message:      rec.CEF.Name,
+		ClassUID:     ocsfClassBase,
+		ClassName:    "Base Event",
+		CategoryUID:  ocsfCategoryOther,
+		CategoryName: "Uncategorized",
+		ActivityID:   ocsfActivityOther,
+		SeverityID:   f.severity(rec.CEF.Severity),
+		Metadata: ocsfMetadata{
+			Version:   ocsfVersion,
+			EventCode: rec.CEF.EventClassID,
+			Product: ocsfProduct{
+				Name:       rec.CEF.DeviceProduct,
+				VendorName: rec.CEF.DeviceVendor,
+				Version:    rec.CEF.DeviceVersion,
+			},
+		},
+	}
+
+	er := rec.Event
+	if er != nil && er.Type != nil {
+		if a, ok := ocsfAuthActivities[strings.ToUpper(*er.Type)]; ok {
+			ev.ClassUID = ocsfClassAuthentication
+			ev.ClassName = "Authentication"
+			ev.CategoryUID = ocsfCategoryIAM
+			ev.CategoryName = "Identity & Access Management"
+			ev.ActivityID = a[0]
+			ev.StatusID = a[1]
+			ev.Status = ocsfStatusNames[a[1]]
+		}
+		ev.Unmapped = map[string]string{"type": *er.Type}
+	}
+	ev.ActivityName = ocsfActivityNames[ev.ActivityID]
+	ev.TypeUID = ev.ClassUID*ocsfTypeFactor + ev.ActivityID
+
+	if er == nil {
+		return ev
+	}
+	if er.RealmID != nil {
+		ev.Metadata.TenantUID = *er.RealmID
+	}
+	if er.UserID != nil || er.HasDetail("username") {
+		ev.User = &ocsfUser{Name: er.GetDetail("username", "")}
+		if er.UserID != nil {
+			ev.User.UID = *er.UserID
+		}
+	}
+	if er.IPAddress != nil {
+		ev.SrcEndpoint = &ocsfEndpoint{IP: *er.IPAddress}
+	}
+	if er.SessionID != nil {
+		ev.Session = &ocsfSession{UID: *er.SessionID}
+	}
+	if er.ClientID != nil {
+		ev.Service = &ocsfService{UID: *er.ClientID}
+	}
+	return ev
+}
+
+// severity returns OCSF severity_id for CEF severity
+func (f *OCSFFormatter) severity(p cefsyslog.Priority) int {
+	if p < 0 || int(p) >= len(ocsfSeverities) {
+		return 0
+	}
+	return ocsfSeverities[p]
+}
@@ -0,0 +1,99 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"testing"
+	"time"
+)
+
+func TestOCSFFormat(t *testing.T) {
+	logout := testRecord("logout")
+	logout.Event.UserID, logout.Event.Details = nil, nil
+	unknown := testRecord("UPDATE_PROFILE")
+	unknown.CEF.Severity = 11
+
+	tests := []struct {
+		name string
+		rec  *Record
+		want string
+	}{
+		{
+			name: "logon failure",
+			rec:  testRecord("LOGIN_ERROR"),
+			want: `{"time":1683205323045,"message":"Event LOGIN_ERROR","class_uid":3002,"class_name":"Authentication",` +
+				`"category_uid":3,"category_name":"Identity \u0026 Access Management","activity_id":1,"activity_name":"Logon",` +
+				`"type_uid":300201,"severity_id":3,"status_id":2,"status":"Failure",` +
+				`"metadata":{"version":"1.1.0","event_code":"LOGIN_ERROR","tenant_uid":"realm",` +
+				`"product":{"name":"LMS","vendor_name":"Swiss Learning Hub AG","version":"1.0.0"}},` +
+				`"user":{"uid":"uid","name":"jdoe"},"src_endpoint":{"ip":"10.0.0.1"},"session":{"uid":"sid"},` +
+				`"service":{"uid":"client"},"unmapped":{"type":"LOGIN_ERROR"}}`,
+		},
+		{
+			name: "logoff success, type in lower case",
+			rec:  logout,
+			want: `{"time":1683205323045,"message":"Event logout","class_uid":3002,"class_name":"Authentication",` +
+				`"category_uid":3,"category_name":"Identity \u0026 Access Management","activity_id":2,"activity_name":"Logoff",` +
+				`"type_uid":300202,"severity_id":3,"status_id":1,"status":"Success",` +
+				`"metadata":{"version":"1.1.0","event_code":"logout","tenant_uid":"realm",` +
+				`"product":{"name":"LMS","vendor_name":"Swiss Learning Hub AG","version":"1.0.0"}},` +
+				`"src_endpoint":{"ip":"10.0.0.1"},"session":{"uid":"sid"},` +
+				`"service":{"uid":"client"},"unmapped":{"type":"logout"}}`,
+		},
+		{
+			name: "unknown type, severity out of range",
+			rec:  unknown,
+			want: `{"time":1683205323045,"message":"Event UPDATE_PROFILE","class_uid":0,"class_name":"Base Event",` +
+				`"category_uid":0,"category_name":"Uncategorized","activity_id":99,"activity_name":"Other",` +
+				`"type_uid":99,"severity_id":0,` +
+				`"metadata":{"version":"1.1.0","event_code":"UPDATE_PROFILE","tenant_uid":"realm",` +
+				`"product":{"name":"LMS","vendor_name":"Swiss Learning Hub AG","version":"1.0.0"}},` +
+				`"user":{"uid":"uid","name":"jdoe"},"src_endpoint":{"ip":"10.0.0.1"},"session":{"uid":"sid"},` +
+				`"service":{"uid":"client"},"unmapped":{"type":"UPDATE_PROFILE"}}`,
+		},
+		{
+			name: "without event",
+			rec:  &Record{Time: time.UnixMilli(1000), CEF: cefsyslog.NewCEF("X", "x", 10)},
+			want: `{"time":1000,"message":"x","class_uid":0,"class_name":"Base Event",` +
+				`"category_uid":0,"category_name":"Uncategorized","activity_id":99,"activity_name":"Other",` +
+				`"type_uid":99,"severity_id":5,` +
+				`"metadata":{"version":"1.1.0","event_code":"X",` +
+				`"product":{"name":"LMS","vendor_name":"Swiss Learning Hub AG","version":"1.0.0"}}}`,
+		},
+	}
+	f, err := NewFormatter(FormatOCSF, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		got, err := f.Format(tt.rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOCSFSeverity(t *testing.T) {
+	f := new(OCSFFormatter)
+	for p, want := range map[cefsyslog.Priority]int{-1: 0, 0: 1, 1: 2, 3: 2, 4: 3, 6: 3, 7: 4, 8: 4, 9: 5, 10: 5, 11: 0} {
+		if got := f.severity(p); got != want {
+			t.Errorf("severity %d: got %d, want %d", p, got, want)
+		}
+	}
+}
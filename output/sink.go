@@ -0,0 +1,164 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"errors"
+	"github.com/swisslearninghub/logsync/cefsyslog"
+	"sync"
+)
+
+// Sink delivers records to a destination
+type Sink interface {
+	Send(rec *Record) error
+	Close() error
+}
+
+// Flusher is implemented by sinks buffering records
+type Flusher interface {
+	Flush() error
+}
+
+// Counter is implemented by sinks providing counters, i.e. of dropped records
+type Counter interface {
+	Counters() map[string]uint64
+}
+
+// Checker is implemented by sinks able to report their connection state
+type Checker interface {
+	Check() error
+}
+
+// delivery keeps the result of the latest delivery attempt of a sink to report it by Check
+type delivery struct {
+	mu  sync.Mutex // guards err
+	err error
+}
+
+// done records result of a delivery attempt and returns err
+func (d *delivery) done(err error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err = err
+	return err
+}
+
+// Check match interface
+func (d *delivery) Check() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// SyslogSink sends formatted records as syslog message
+type SyslogSink struct {
+	writer   *cefsyslog.Writer
+	format   Formatter
+	truncate []string
+}
+
+// NewSyslogSink returns Sink. Extension fields in truncate are shortened in given order for messages exceeding max
+// size of writer.
+func NewSyslogSink(writer *cefsyslog.Writer, format Formatter, truncate []string) *SyslogSink {
+	return &SyslogSink{writer: writer, format: format, truncate: truncate}
+}
+
+// Send match interface. In async mode records are queued, Flush and Close return records which could not be sent
+// as *BatchError
+func (s *SyslogSink) Send(rec *Record) error {
+	msg, err := s.format.Format(rec)
+	if err != nil {
+		return err
+	}
+	var shrink func(avail int) string
+	if len(s.truncate) > 0 {
+		shrink = func(avail int) string {
+			return s.shrink(rec, msg, avail)
+		}
+	}
+	return s.writer.LogFit(rec.Time, rec.LogLevel, msg, shrink, rec)
+}
+
+// shrink returns message with configured extension fields truncated until it fits into avail
+func (s *SyslogSink) shrink(rec *Record, msg string, avail int) string {
+	cef := *rec.CEF
+	cef.Extension = cefsyslog.Extensions{}
+	for key, value := range rec.CEF.Extension {
+		cef.Extension[key] = value
+	}
+	r := *rec
+	r.CEF = &cef
+
+	for _, key := range s.truncate {
+		for len(msg) > avail && cef.Extension[key] != "" {
+			value := cef.Extension[key]
+			cef.Extension[key] = cefsyslog.TruncateUTF8(value, len(value)-(len(msg)-avail))
+			m, err := s.format.Format(&r)
+			if err != nil {
+				return msg
+			}
+			msg = m
+		}
+	}
+	return msg
+}
+
+// Counters match interface
+func (s *SyslogSink) Counters() map[string]uint64 {
+	return map[string]uint64{
+		"dropped":   s.writer.Dropped(),
+		"oversized": s.writer.Oversized(),
+	}
+}
+
+// Close match interface
+func (s *SyslogSink) Close() error {
+	return unsentRecords(s.writer.Close())
+}
+
+// Flush match interface
+func (s *SyslogSink) Flush() error {
+	return unsentRecords(s.writer.Flush())
+}
+
+// unsentRecords returns *BatchError holding records of messages the writer could not send, err otherwise
+func unsentRecords(err error) error {
+	var ue *cefsyslog.UnsentError
+	if !errors.As(err, &ue) {
+		return err
+	}
+	be := &BatchError{Err: ue}
+	if ue.Err != nil {
+		be.Err = ue.Err
+	}
+	for _, ref := range ue.Refs {
+		if rec, ok := ref.(*Record); ok {
+			be.Records = append(be.Records, rec)
+		}
+	}
+	return be
+}
+
+// Check match interface
+func (s *SyslogSink) Check() error {
+	n, err := s.writer.ConnState()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("not connected")
+	}
+	return nil
+}
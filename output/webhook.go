@@ -0,0 +1,190 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Webhook defaults
+const (
+	WebhookSignatureHeader = "X-Logsync-Signature"
+	webhookSignaturePrefix = "sha256="
+	webhookContentType     = "application/json"
+	webhookContentTypeText = "text/plain; charset=utf-8"
+)
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		bs, err := json.Marshal(v)
+		return string(bs), err
+	},
+}
+
+// WebhookOptions configure a WebhookSink
+type WebhookOptions struct {
+	URL             string
+	Method          string            // POST if empty
+	Headers         map[string]string // additional request headers
+	Secret          string            // key for HMAC-SHA256 signature of body, unsigned if empty
+	SignatureHeader string            // header holding signature, WebhookSignatureHeader if empty
+	Timeout         time.Duration
+	Retries         int
+	RetryWait       time.Duration
+	BatchSize       int             // records per request, single record requests if less than 2
+	Template        string          // text/template rendering body, formatted records as JSON if empty
+	ContentType     string          // content type of body, derived from body if empty
+	Context         context.Context // waits for retries give up once done (optional)
+}
+
+// WebhookSink posts records to an HTTP endpoint as JSON or rendered by template
+type WebhookSink struct {
+	opts   WebhookOptions
+	format Formatter
+	tmpl   *template.Template
+	http   *httpRetry
+	batch  *batch
+	delivery
+}
+
+// NewWebhookSink returns Sink. Format must render JSON unless a template is given.
+// Template data is the record or, if batched, the slice of records.
+func NewWebhookSink(opts WebhookOptions, format Formatter) (*WebhookSink, error) {
+	if opts.Method == "" {
+		opts.Method = http.MethodPost
+	}
+	if opts.SignatureHeader == "" {
+		opts.SignatureHeader = WebhookSignatureHeader
+	}
+	s := &WebhookSink{
+		opts:   opts,
+		format: format,
+		http:   newHTTPRetry(opts.Context, opts.Timeout, opts.Retries, opts.RetryWait),
+	}
+	if opts.Template != "" {
+		var err error
+		if s.tmpl, err = template.New("webhook").Funcs(webhookFuncs).Parse(opts.Template); err != nil {
+			return nil, err
+		}
+	}
+	if opts.BatchSize > 1 {
+		s.batch = &batch{size: opts.BatchSize, send: s.post}
+	}
+	return s, nil
+}
+
+// Send match interface
+func (s *WebhookSink) Send(rec *Record) error {
+	if s.batch != nil {
+		return s.batch.add(rec)
+	}
+	return s.post([]*Record{rec})
+}
+
+// Flush match interface
+func (s *WebhookSink) Flush() error {
+	if s.batch != nil {
+		return s.batch.Flush()
+	}
+	return nil
+}
+
+// Close match interface. Remaining records are sent
+func (s *WebhookSink) Close() error {
+	return s.Flush()
+}
+
+// post sends records in a single request
+func (s *WebhookSink) post(recs []*Record) error {
+	body, err := s.body(recs)
+	if err != nil {
+		return err
+	}
+	_, err = s.http.do(func() (*http.Request, error) {
+		req, err := http.NewRequest(s.opts.Method, s.opts.URL, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", s.contentType(body))
+		for key, value := range s.opts.Headers {
+			req.Header.Set(key, value)
+		}
+		if s.opts.Secret != "" {
+			req.Header.Set(s.opts.SignatureHeader, s.sign(body))
+		}
+		return req, nil
+	})
+	return s.done(err)
+}
+
+// body returns request body rendered by template or formatter
+func (s *WebhookSink) body(recs []*Record) ([]byte, error) {
+	var buf bytes.Buffer
+	if s.tmpl != nil {
+		var data interface{} = recs
+		if s.batch == nil {
+			data = recs[0]
+		}
+		if err := s.tmpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	msgs := make([]string, 0, len(recs))
+	for _, rec := range recs {
+		msg, err := s.format.Format(rec)
+		if err != nil {
+			return nil, err
+		}
+		if !json.Valid([]byte(msg)) {
+			return nil, fmt.Errorf("webhook format does not render json")
+		}
+		msgs = append(msgs, msg)
+	}
+	if s.batch == nil {
+		return []byte(msgs[0]), nil
+	}
+	return []byte("[" + strings.Join(msgs, ",") + "]"), nil
+}
+
+// contentType returns configured content type. Otherwise body is sent as JSON if valid, as text if rendered by
+// template otherwise
+func (s *WebhookSink) contentType(body []byte) string {
+	if s.opts.ContentType != "" {
+		return s.opts.ContentType
+	}
+	if s.tmpl != nil && !json.Valid(body) {
+		return webhookContentTypeText
+	}
+	return webhookContentType
+}
+
+// sign returns HMAC-SHA256 signature of body
+func (s *WebhookSink) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.opts.Secret))
+	mac.Write(body)
+	return webhookSignaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
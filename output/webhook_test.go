@@ -0,0 +1,238 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package output
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRequest is a request received by webhookStandIn
+type webhookRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+// webhookStandIn is a local endpoint recording requests. The first fail requests are answered with status
+type webhookStandIn struct {
+	server   *httptest.Server
+	mu       sync.Mutex
+	requests []webhookRequest
+	fail     int
+	status   int
+}
+
+// newWebhookStandIn starts stand-in, closed at end of test
+func newWebhookStandIn(t *testing.T) *webhookStandIn {
+	h := &webhookStandIn{}
+	h.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := io.ReadAll(r.Body)
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.requests = append(h.requests, webhookRequest{method: r.Method, header: r.Header.Clone(), body: string(bs)})
+		if len(h.requests) <= h.fail {
+			w.WriteHeader(h.status)
+		}
+	}))
+	t.Cleanup(h.server.Close)
+	return h
+}
+
+// received returns copy of received requests
+func (h *webhookStandIn) received() []webhookRequest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]webhookRequest{}, h.requests...)
+}
+
+func TestWebhookBody(t *testing.T) {
+	rec := &Record{Time: time.UnixMilli(1000)}
+	tests := []struct {
+		name        string
+		opts        WebhookOptions
+		records     int
+		body        string
+		contentType string
+	}{
+		{
+			name:        "single",
+			records:     1,
+			body:        `{"a":1}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "batch",
+			opts:        WebhookOptions{BatchSize: 2},
+			records:     2,
+			body:        `[{"a":1},{"a":1}]`,
+			contentType: "application/json",
+		},
+		{
+			name:        "json template",
+			opts:        WebhookOptions{Template: `{"text":{{ json .Time.UnixMilli }}}`},
+			records:     1,
+			body:        `{"text":1000}`,
+			contentType: "application/json",
+		},
+		{
+			name:        "text template",
+			opts:        WebhookOptions{Template: `at {{ .Time.UnixMilli }}`},
+			records:     1,
+			body:        `at 1000`,
+			contentType: "text/plain; charset=utf-8",
+		},
+		{
+			name:        "configured content type",
+			opts:        WebhookOptions{Template: `a=1`, ContentType: "application/x-www-form-urlencoded"},
+			records:     1,
+			body:        `a=1`,
+			contentType: "application/x-www-form-urlencoded",
+		},
+	}
+	for _, tt := range tests {
+		h := newWebhookStandIn(t)
+		tt.opts.URL = h.server.URL
+		sink, err := NewWebhookSink(tt.opts, testFormat(`{"a":1}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < tt.records; i++ {
+			if err = sink.Send(rec); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		if err = sink.Close(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		reqs := h.received()
+		if len(reqs) != 1 {
+			t.Fatalf("%s: got %d request(s), want 1", tt.name, len(reqs))
+		}
+		if reqs[0].method != http.MethodPost || reqs[0].body != tt.body {
+			t.Errorf("%s: got %s %s, want POST %s", tt.name, reqs[0].method, reqs[0].body, tt.body)
+		}
+		if ct := reqs[0].header.Get("Content-Type"); ct != tt.contentType {
+			t.Errorf("%s: got content type %s, want %s", tt.name, ct, tt.contentType)
+		}
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	h := newWebhookStandIn(t)
+	sink, err := NewWebhookSink(WebhookOptions{
+		URL:     h.server.URL,
+		Method:  http.MethodPut,
+		Headers: map[string]string{"Authorization": "Bearer tok"},
+		Secret:  "secret",
+	}, testFormat(`{"a":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Send(&Record{}); err != nil {
+		t.Fatal(err)
+	}
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(`{"a":1}`))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	req := h.received()[0]
+	if req.method != http.MethodPut || req.header.Get("Authorization") != "Bearer tok" {
+		t.Errorf("got %s with authorization %q", req.method, req.header.Get("Authorization"))
+	}
+	if got := req.header.Get(WebhookSignatureHeader); got != want {
+		t.Errorf("signature: got %s, want %s", got, want)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	h := newWebhookStandIn(t)
+	h.fail, h.status = 2, http.StatusServiceUnavailable
+	sink, err := NewWebhookSink(WebhookOptions{URL: h.server.URL, Retries: 2, RetryWait: time.Millisecond}, testFormat(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Send(&Record{}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(h.received()); n != 3 {
+		t.Errorf("got %d request(s), want 3", n)
+	}
+
+	// client errors are not retried
+	h = newWebhookStandIn(t)
+	h.fail, h.status = 1, http.StatusBadRequest
+	sink, err = NewWebhookSink(WebhookOptions{URL: h.server.URL, Retries: 2, RetryWait: time.Millisecond}, testFormat(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var se *HTTPStatusError
+	if err = sink.Send(&Record{}); !errors.As(err, &se) || se.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %v, want status %d", err, http.StatusBadRequest)
+	}
+	if n := len(h.received()); n != 1 {
+		t.Errorf("got %d request(s), want 1", n)
+	}
+	if sink.Check() == nil {
+		t.Error("delivery state: got ok after failed request")
+	}
+}
+
+func TestWebhookRetryCanceled(t *testing.T) {
+	h := newWebhookStandIn(t)
+	h.fail, h.status = 1, http.StatusServiceUnavailable
+	ctx, cancel := context.WithCancel(context.Background())
+	sink, err := NewWebhookSink(WebhookOptions{
+		URL:       h.server.URL,
+		Retries:   1,
+		RetryWait: time.Hour,
+		Context:   ctx,
+	}, testFormat(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(10*time.Millisecond, cancel)
+	start := time.Now()
+	var se *HTTPStatusError
+	if err = sink.Send(&Record{}); !errors.As(err, &se) {
+		t.Errorf("got %v, want error of last attempt", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("retry wait not interrupted, returned after %s", time.Since(start))
+	}
+}
+
+func TestWebhookFormatNotJSON(t *testing.T) {
+	h := newWebhookStandIn(t)
+	sink, err := NewWebhookSink(WebhookOptions{URL: h.server.URL}, testFormat("CEF:0|"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = sink.Send(&Record{}); err == nil {
+		t.Error("got no error for format not rendering json")
+	}
+	if n := len(h.received()); n != 0 {
+		t.Errorf("got %d request(s), want none", n)
+	}
+}
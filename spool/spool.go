@@ -0,0 +1,432 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spool
+
+// Persistent delivery queue for records which could not be sent to an output
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/swisslearninghub/logsync/output"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	segmentExt  = ".seg"
+	lockName    = ".lock"
+	segmentSize = 8 << 20
+	segmentsMin = 8 // segments spool max size is split into at least
+	dirPerm     = 0700
+	filePerm    = 0600
+)
+
+// bufferSize is the maximum size of a single spooled entry
+const bufferSize = 1 << 20
+
+var (
+	ErrSpoolFull = errors.New("spool full")
+	ErrLocked    = errors.New("spool in use by another process")
+)
+
+// Entry is a spooled record for a named output
+type Entry struct {
+	Output  string         `json:"output"`
+	Spooled time.Time      `json:"spooled"`
+	Record  *output.Record `json:"record"`
+}
+
+// Stats summarizes spool content
+type Stats struct {
+	Segments int
+	Entries  int
+	Bytes    int64
+	Oldest   time.Time
+	Newest   time.Time
+	Outputs  map[string]int
+}
+
+// ReplayResult counts entries handled by Replay
+type ReplayResult struct {
+	Sent    int
+	Failed  int
+	Expired int
+}
+
+// Spool stores entries in append-only segment files within a directory
+type Spool struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	segSize int64
+	mu      sync.Mutex // guards file, size, seq, counts
+	file    *os.File
+	size    int64       // size of current segment
+	seq     int         // sequence of current segment
+	counts  map[int]int // entries per segment
+	lock    *os.File    // lock file while locked (see Lock)
+}
+
+// Open returns Spool using given directory, which is created if not already exists.
+// Zero maxSize or maxAge disables the limit.
+func Open(dir string, maxSize int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, maxSize: maxSize, maxAge: maxAge, segSize: segmentSize, counts: map[int]int{}}
+	if maxSize > 0 && maxSize/segmentsMin < s.segSize {
+		s.segSize = maxSize / segmentsMin
+	}
+	segs, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segs) > 0 {
+		s.seq = segs[len(segs)-1]
+	}
+	for _, seq := range segs {
+		if err = s.read(seq, func(*Entry) { s.counts[seq]++ }); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Add appends record for given output to current segment. Oldest segments are dropped if spool exceeds max size.
+func (s *Spool) Add(name string, rec *output.Record) error {
+	return s.append(&Entry{Output: name, Spooled: time.Now(), Record: rec})
+}
+
+// append writes entry to current segment
+func (s *Spool) append(e *Entry) error {
+	bs, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	bs = append(bs, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err = s.makeRoom(int64(len(bs))); err != nil {
+		return err
+	}
+	if s.file == nil || s.size+int64(len(bs)) > s.segSize {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(bs)
+	s.size += int64(n)
+	if err == nil {
+		s.counts[s.seq]++
+	}
+	return err
+}
+
+// Replay passes all spooled entries to send. Entries send fails for are spooled again, entries older than max age
+// are dropped. Processed segments are removed.
+func (s *Spool) Replay(send func(e *Entry) error) (ReplayResult, error) {
+	var res ReplayResult
+
+	s.mu.Lock()
+	err := s.closeSegment()
+	segs, errSegs := s.segments()
+	s.mu.Unlock()
+
+	if err != nil {
+		return res, err
+	}
+	if errSegs != nil {
+		return res, errSegs
+	}
+
+	for _, seq := range segs {
+		var failed []*Entry
+		err = s.read(seq, func(e *Entry) {
+			if s.expired(e) {
+				res.Expired++
+				return
+			}
+			if send(e) != nil {
+				res.Failed++
+				failed = append(failed, e)
+				return
+			}
+			res.Sent++
+		})
+		if err != nil {
+			// segment may have been dropped to make room for failed entries
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return res, err
+		}
+		for _, e := range failed {
+			if err = s.append(e); err != nil {
+				return res, err
+			}
+		}
+		if err = os.Remove(s.path(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return res, err
+		}
+		s.mu.Lock()
+		delete(s.counts, seq)
+		s.mu.Unlock()
+	}
+
+	return res, nil
+}
+
+// Stats returns summary of spool content
+func (s *Spool) Stats() (*Stats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segs, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	st := &Stats{Segments: len(segs), Outputs: map[string]int{}}
+	for _, seq := range segs {
+		var fi os.FileInfo
+		if fi, err = os.Stat(s.path(seq)); err != nil {
+			return nil, err
+		}
+		st.Bytes += fi.Size()
+		err = s.read(seq, func(e *Entry) {
+			st.Entries++
+			st.Outputs[e.Output]++
+			if st.Oldest.IsZero() || e.Spooled.Before(st.Oldest) {
+				st.Oldest = e.Spooled
+			}
+			if e.Spooled.After(st.Newest) {
+				st.Newest = e.Spooled
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// Size returns count of spooled entries and total size of segments without reading them
+func (s *Spool) Size() (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	segs, err := s.segments()
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	for _, seq := range segs {
+		fi, err := os.Stat(s.path(seq))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return 0, 0, err
+		}
+		size += fi.Size()
+	}
+	var entries int
+	for _, n := range s.counts {
+		entries += n
+	}
+	return entries, size, nil
+}
+
+// Purge removes all spooled entries
+func (s *Spool) Purge() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.closeSegment(); err != nil {
+		return err
+	}
+	segs, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for _, seq := range segs {
+		if err = os.Remove(s.path(seq)); err != nil {
+			return err
+		}
+		delete(s.counts, seq)
+	}
+	return nil
+}
+
+// Lock takes an exclusive lock on the spool directory, held until Close. Processes writing to or purging the spool
+// must hold it. Returns ErrLocked if another process does
+func (s *Spool) Lock() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.lock != nil {
+		return nil
+	}
+	f, err := os.OpenFile(filepath.Join(s.dir, lockName), os.O_RDWR|os.O_CREATE, filePerm)
+	if err != nil {
+		return err
+	}
+	if err = lockFile(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	s.lock = f
+	return nil
+}
+
+// Close closes current segment and releases lock
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.closeSegment()
+	if s.lock != nil {
+		// closing releases the lock
+		_ = s.lock.Close()
+		s.lock = nil
+	}
+	return err
+}
+
+// expired returns true if entry is older than max age
+func (s *Spool) expired(e *Entry) bool {
+	return s.maxAge > 0 && time.Since(e.Spooled) > s.maxAge
+}
+
+// read passes all entries of segment to fn. Undecodable lines are skipped.
+func (s *Spool) read(seq int, fn func(e *Entry)) error {
+	f, err := os.Open(s.path(seq))
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), bufferSize)
+	for sc.Scan() {
+		e := new(Entry)
+		if json.Unmarshal(sc.Bytes(), e) != nil || e.Record == nil {
+			continue
+		}
+		fn(e)
+	}
+	return sc.Err()
+}
+
+// makeRoom removes oldest segments until n bytes fit into max size. It must be called with s.mu held.
+func (s *Spool) makeRoom(n int64) error {
+	if s.maxSize <= 0 {
+		return nil
+	}
+	if n > s.maxSize {
+		return ErrSpoolFull
+	}
+	segs, err := s.segments()
+	if err != nil {
+		return err
+	}
+	var total int64
+	sizes := map[int]int64{}
+	for _, seq := range segs {
+		var fi os.FileInfo
+		if fi, err = os.Stat(s.path(seq)); err != nil {
+			return err
+		}
+		sizes[seq] = fi.Size()
+		total += fi.Size()
+	}
+	for _, seq := range segs {
+		if total+n <= s.maxSize {
+			return nil
+		}
+		if seq == s.seq {
+			if err = s.closeSegment(); err != nil {
+				return err
+			}
+		}
+		if err = os.Remove(s.path(seq)); err != nil {
+			return err
+		}
+		delete(s.counts, seq)
+		total -= sizes[seq]
+	}
+	return nil
+}
+
+// rotate closes current and opens a new segment. It must be called with s.mu held.
+func (s *Spool) rotate() error {
+	if err := s.closeSegment(); err != nil {
+		return err
+	}
+	s.seq++
+	f, err := os.OpenFile(s.path(s.seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND, filePerm)
+	if err != nil {
+		return err
+	}
+	s.file = f
+	s.size = 0
+	return nil
+}
+
+// closeSegment closes current segment. It must be called with s.mu held.
+func (s *Spool) closeSegment() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	s.size = 0
+	return err
+}
+
+// segments returns sorted sequences of existing segments
+func (s *Spool) segments() ([]int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segs []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.Atoi(strings.TrimSuffix(name, segmentExt))
+		if err != nil {
+			continue
+		}
+		segs = append(segs, seq)
+	}
+	sort.Ints(segs)
+	return segs, nil
+}
+
+// path returns file path of segment
+func (s *Spool) path(seq int) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", seq, segmentExt))
+}
@@ -0,0 +1,239 @@
+// Copyright 2023 Swiss Learning Hub AG
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spool
+
+import (
+	"errors"
+	"github.com/swisslearninghub/logsync/output"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testRecord returns record identified by source
+func testRecord(id string) *output.Record {
+	return &output.Record{Time: time.UnixMilli(1000), Source: id}
+}
+
+// replayed returns output and source of replayed entries, failing those send returns an error for
+func replayed(t *testing.T, s *Spool, fail map[string]bool) ([]string, ReplayResult) {
+	var ids []string
+	res, err := s.Replay(func(e *Entry) error {
+		ids = append(ids, e.Output+"/"+e.Record.Source)
+		if fail[e.Record.Source] {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ids, res
+}
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		if err = s.Add("out", testRecord(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// entries survive reopening
+	if s, err = Open(dir, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	if n, _, err := s.Size(); err != nil || n != 3 {
+		t.Fatalf("size after reopen: got %d, %v, want 3 entries", n, err)
+	}
+
+	ids, res := replayed(t, s, map[string]bool{"2": true})
+	if !reflect.DeepEqual(ids, []string{"out/1", "out/2", "out/3"}) {
+		t.Errorf("got %v, want entries in spooled order", ids)
+	}
+	if res != (ReplayResult{Sent: 2, Failed: 1}) {
+		t.Errorf("got %+v, want 2 sent and 1 failed", res)
+	}
+
+	// failed entry stays in spool
+	if ids, _ = replayed(t, s, nil); !reflect.DeepEqual(ids, []string{"out/2"}) {
+		t.Errorf("second replay: got %v, want failed entry only", ids)
+	}
+	if n, _, _ := s.Size(); n != 0 {
+		t.Errorf("got %d entries after replay, want none", n)
+	}
+}
+
+func TestReplayExpired(t *testing.T) {
+	s, err := Open(t.TempDir(), 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	if err = s.append(&Entry{Output: "out", Spooled: time.Now().Add(-2 * time.Hour), Record: testRecord("1")}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Add("out", testRecord("2")); err != nil {
+		t.Fatal(err)
+	}
+	ids, res := replayed(t, s, nil)
+	if !reflect.DeepEqual(ids, []string{"out/2"}) || res.Expired != 1 {
+		t.Errorf("got %v and %+v, want expired entry dropped", ids, res)
+	}
+}
+
+func TestMakeRoom(t *testing.T) {
+	const maxSize = 8 << 10 // segments of 1 KiB
+	s, err := Open(t.TempDir(), maxSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+
+	var added int
+	for i := 0; i < 200; i++ {
+		if err = s.Add("out", testRecord("1")); err != nil {
+			t.Fatal(err)
+		}
+		added++
+	}
+	entries, size, err := s.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size > maxSize {
+		t.Errorf("got %d bytes, want at most %d", size, maxSize)
+	}
+	if entries == 0 || entries >= added {
+		t.Errorf("got %d of %d entries, want oldest segments dropped", entries, added)
+	}
+	st, err := s.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Entries != entries || st.Bytes != size {
+		t.Errorf("stats: got %d entries and %d bytes, size: %d entries and %d bytes", st.Entries, st.Bytes, entries, size)
+	}
+
+	big := &output.Record{Time: time.UnixMilli(1000), Source: string(make([]byte, maxSize))}
+	if err = s.Add("out", big); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("entry exceeding max size: got %v, want %v", err, ErrSpoolFull)
+	}
+}
+
+func TestTornSegment(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"1", "2"} {
+		if err = s.Add("out", testRecord(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := s.path(s.seq)
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// crash while writing the third entry
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, filePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.WriteString(`{"output":"out","spooled":"2023-01-0`); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if s, err = Open(dir, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	if n, _, _ := s.Size(); n != 2 {
+		t.Errorf("got %d entries, want 2 complete ones", n)
+	}
+	if err = s.Add("out", testRecord("3")); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := replayed(t, s, nil); !reflect.DeepEqual(ids, []string{"out/1", "out/2", "out/3"}) {
+		t.Errorf("got %v, want entries around torn one", ids)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = s.Close() }()
+	if err = s.Add("out", testRecord("1")); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Purge(); err != nil {
+		t.Fatal(err)
+	}
+	if segs, _ := s.segments(); len(segs) != 0 {
+		t.Errorf("got %d segment(s) after purge", len(segs))
+	}
+	if n, size, _ := s.Size(); n != 0 || size != 0 {
+		t.Errorf("got %d entries and %d bytes after purge", n, size)
+	}
+
+	// spool stays usable
+	if err = s.Add("out", testRecord("2")); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := replayed(t, s, nil); !reflect.DeepEqual(ids, []string{"out/2"}) {
+		t.Errorf("got %v after purge, want entry added since", ids)
+	}
+}
+
+func TestLock(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = b.Close() }()
+
+	if err = a.Lock(); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Lock(); !errors.Is(err, ErrLocked) {
+		t.Errorf("got %v while locked, want %v", err, ErrLocked)
+	}
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Lock(); err != nil {
+		t.Errorf("got %v after lock released", err)
+	}
+}